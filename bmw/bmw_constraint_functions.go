@@ -0,0 +1,235 @@
+package bmw
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Organized92/route2bimmer/gpx"
+)
+
+// CheckConstraints checks the GPX data against the limits of the navigation system:
+// the number of waypoints per route, the length of names and texts and characters
+// the navigation system cannot show. If fix is true, the GPX data is changed to
+// comply with the limits and the changes are returned, and the coordinates are
+// rounded to the supported decimal places as well. Otherwise a ConstraintError
+// listing all violations is returned.
+func CheckConstraints(gpxFile *gpx.GPX, headUnit HeadUnit, fix bool) ([]Violation, error) {
+	var checker = constraintChecker{headUnit: headUnit, fix: fix}
+	var err error
+
+	// Metadata
+	checker.checkName(&gpxFile.Metadata.Name, "metadata/name")
+	checker.checkText(&gpxFile.Metadata.Description, "metadata/desc")
+	checker.checkExtensions(&gpxFile.Metadata.Extensions, "metadata/extensions")
+
+	// Routes
+	for i := range gpxFile.Routes {
+		var route = &gpxFile.Routes[i]
+		var routePath = "rte[" + strconv.Itoa(i+1) + "]"
+		checker.checkName(&route.Name, routePath+"/name")
+		checker.checkText(&route.Description, routePath+"/desc")
+		checker.checkExtensions(&route.Extensions, routePath+"/extensions")
+
+		// Loop over the waypoints
+		for j := range route.RouteWaypoints {
+			var waypoint = &route.RouteWaypoints[j]
+			var waypointPath = routePath + "/rtept[" + strconv.Itoa(j+1) + "]"
+			checker.checkCoordinate(&waypoint.Latitude)
+			checker.checkCoordinate(&waypoint.Longitude)
+			checker.checkName(&waypoint.Name, waypointPath+"/name")
+			checker.checkText(&waypoint.Description, waypointPath+"/desc")
+			checker.checkAddress(waypoint, waypointPath)
+		}
+
+		checker.checkWaypointCount(route, routePath)
+	}
+
+	if !fix && len(checker.violations) > 0 {
+		err = &ConstraintError{HeadUnit: headUnit.Name, Violations: checker.violations}
+	}
+	return checker.violations, err
+}
+
+// Error lists all violations, one per line
+func (constraintError *ConstraintError) Error() string {
+	var lines = []string{"the route breaks " + strconv.Itoa(len(constraintError.Violations)) + " limits of the head unit \"" + constraintError.HeadUnit + "\":"}
+	for _, violation := range constraintError.Violations {
+		lines = append(lines, violation.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// String returns the element and the rule it breaks
+func (violation Violation) String() string {
+	if violation.Fixed {
+		return violation.Element + ": " + violation.Rule + " (fixed)"
+	}
+	return violation.Element + ": " + violation.Rule
+}
+
+// constraintChecker collects the violations found in a GPX file
+type constraintChecker struct {
+	headUnit   HeadUnit
+	fix        bool
+	violations []Violation
+}
+
+// report adds a violation
+func (checker *constraintChecker) report(element string, rule string) {
+	checker.violations = append(checker.violations, Violation{Element: element, Rule: rule, Fixed: checker.fix})
+}
+
+// checkName checks a name, which is shown on a single line
+func (checker *constraintChecker) checkName(name *string, element string) {
+	checker.checkString(name, element, checker.headUnit.MaxNameLength, false)
+}
+
+// checkText checks a description, which may contain line breaks
+func (checker *constraintChecker) checkText(text *string, element string) {
+	checker.checkString(text, element, checker.headUnit.MaxTextLength, true)
+}
+
+// checkExtensions checks the translated names and descriptions
+func (checker *constraintChecker) checkExtensions(extensions *gpx.TextExtensions, element string) {
+	for i := range extensions.Names {
+		checker.checkName(&extensions.Names[i].Value, element+"/name["+strconv.Itoa(i+1)+"]")
+	}
+	for i := range extensions.Descriptions {
+		checker.checkText(&extensions.Descriptions[i].Value, element+"/desc["+strconv.Itoa(i+1)+"]")
+	}
+}
+
+// checkAddress checks the address of a waypoint, no matter where it comes from. If
+// anything has to be fixed, the fixed address is stored in the waypoint.
+func (checker *constraintChecker) checkAddress(waypoint *gpx.RouteWaypoint, element string) {
+	var address = waypoint.GetAddress()
+	var count = len(checker.violations)
+
+	checker.checkName(&address.Country, element+" address country")
+	checker.checkName(&address.State, element+" address state")
+	checker.checkName(&address.City, element+" address city")
+	checker.checkName(&address.PostalCode, element+" address postal code")
+	checker.checkName(&address.Street, element+" address street")
+	checker.checkName(&address.HouseNumber, element+" address house number")
+
+	if checker.fix && len(checker.violations) > count {
+		waypoint.Address = address
+	}
+}
+
+// checkString removes characters the navigation system cannot show and shortens
+// texts which are too long
+func (checker *constraintChecker) checkString(text *string, element string, maxLength int, multiline bool) {
+	// Unsupported characters
+	var cleaned = strings.Map(func(r rune) rune {
+		if multiline && r == '\n' {
+			return r
+		}
+		if r == '\t' || r == '\r' || r == '\n' {
+			return ' '
+		}
+		if !isSupportedRune(r) {
+			return -1
+		}
+		return r
+	}, *text)
+	if cleaned != *text {
+		checker.report(element, "contains characters the head unit cannot show")
+		if checker.fix {
+			*text = cleaned
+		}
+	}
+
+	// Length
+	if maxLength > 0 && utf8.RuneCountInString(*text) > maxLength {
+		checker.report(element, "is longer than "+strconv.Itoa(maxLength)+" characters")
+		if checker.fix {
+			*text = strings.TrimSpace(string([]rune(*text)[:maxLength]))
+		}
+	}
+}
+
+// fitText makes a text created by route2bimmer comply with the limits of the head
+// unit, the same way CheckConstraints fixes the texts of the GPX file. These texts
+// are not part of the GPX file, so the changes are not reported.
+func fitText(text string, options Options) string {
+	if options.HeadUnit == nil {
+		return text
+	}
+	var checker = constraintChecker{headUnit: *options.HeadUnit, fix: true}
+	checker.checkText(&text, "")
+	return text
+}
+
+// isSupportedRune tells if the navigation system can show a character. Control
+// characters, characters outside the Basic Multilingual Plane (e.g. emoji), private use
+// characters and the Unicode replacement character are not supported.
+func isSupportedRune(r rune) bool {
+	return !unicode.IsControl(r) && r <= 0xFFFF && r != utf8.RuneError && !unicode.Is(unicode.Co, r)
+}
+
+// checkCoordinate rounds coordinates with more decimal places than supported. Route
+// planners write 7 or more decimal places, and the route files are written with the
+// supported precision anyway, so this is not reported. Rounding here only makes
+// length and duration match the coordinates the navigation system gets.
+func (checker *constraintChecker) checkCoordinate(coordinate *float64) {
+	var decimals = checker.headUnit.CoordinateDecimals
+	if decimals <= 0 || !checker.fix {
+		return
+	}
+	*coordinate, _ = strconv.ParseFloat(strconv.FormatFloat(*coordinate, 'f', decimals, 64), 64)
+}
+
+// checkWaypointCount checks the number of waypoints of a route. If there are too
+// many, the waypoints the car has to stop at are kept and the others are thinned
+// out evenly.
+func (checker *constraintChecker) checkWaypointCount(route *gpx.Route, element string) {
+	var maxWaypoints = checker.headUnit.MaxWaypoints
+	var count = len(route.RouteWaypoints)
+	if maxWaypoints < 2 || count <= maxWaypoints {
+		return
+	}
+
+	checker.report(element, "has "+strconv.Itoa(count)+" waypoints, only "+strconv.Itoa(maxWaypoints)+" are supported")
+	if !checker.fix {
+		return
+	}
+
+	// Waypoints which have to be kept and the optional ones
+	var keep = make([]bool, count)
+	var required []int
+	var optional []int
+	for i := range route.RouteWaypoints {
+		if route.IsAlways(i) {
+			required = append(required, i)
+		} else {
+			optional = append(optional, i)
+		}
+	}
+
+	if len(required) > maxWaypoints {
+		// Even the important waypoints are too many, keep start and end
+		for i := 0; i < maxWaypoints; i++ {
+			keep[required[int(math.Round(float64(i)*float64(len(required)-1)/float64(maxWaypoints-1)))]] = true
+		}
+	} else {
+		for _, i := range required {
+			keep[i] = true
+		}
+		var free = maxWaypoints - len(required)
+		for i := 0; i < free; i++ {
+			keep[optional[int(math.Round((float64(i)+0.5)*float64(len(optional))/float64(free)-0.5))]] = true
+		}
+	}
+
+	var waypoints []gpx.RouteWaypoint
+	for i, waypoint := range route.RouteWaypoints {
+		if keep[i] {
+			waypoints = append(waypoints, waypoint)
+		}
+	}
+	route.RouteWaypoints = waypoints
+}
@@ -0,0 +1,114 @@
+package bmw
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/Organized92/route2bimmer/gpx"
+)
+
+// testRoute returns a route with the given number of waypoints, named by their index
+func testRoute(count int, always ...int) gpx.Route {
+	var route gpx.Route
+	for i := 0; i < count; i++ {
+		route.RouteWaypoints = append(route.RouteWaypoints, gpx.RouteWaypoint{Name: strconv.Itoa(i), Latitude: 48, Longitude: 11 + float64(i)/100})
+	}
+	for _, i := range always {
+		route.RouteWaypoints[i].Always = true
+	}
+	return route
+}
+
+// waypointNames returns the names of the waypoints of a route
+func waypointNames(route gpx.Route) string {
+	var names string
+	for _, waypoint := range route.RouteWaypoints {
+		names = names + waypoint.Name + " "
+	}
+	return names
+}
+
+func TestCheckWaypointCount(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		route        gpx.Route
+		maxWaypoints int
+		expected     string
+	}{
+		// Start, end and two of the optional waypoints, spread evenly
+		{"optional", testRoute(8), 4, "0 2 5 7 "},
+		// The waypoints to stop at are kept, even next to each other
+		{"optional with always", testRoute(8, 1), 4, "0 1 4 7 "},
+		// Too many waypoints to stop at, start and end are kept
+		{"required only", testRoute(5, 1, 2, 3), 3, "0 2 4 "},
+		// Within the limit
+		{"unchanged", testRoute(3), 3, "0 1 2 "},
+	} {
+		var checker = constraintChecker{headUnit: HeadUnit{MaxWaypoints: test.maxWaypoints}, fix: true}
+		var route = test.route
+		checker.checkWaypointCount(&route, "rte[1]")
+		if names := waypointNames(route); names != test.expected {
+			t.Errorf("%s: waypoints %q kept, expected %q", test.name, names, test.expected)
+		}
+		if changed := test.expected != waypointNames(test.route); changed != (len(checker.violations) == 1) {
+			t.Errorf("%s: %d violations reported", test.name, len(checker.violations))
+		}
+	}
+}
+
+func TestCheckWaypointCountStrict(t *testing.T) {
+	var checker = constraintChecker{headUnit: HeadUnit{MaxWaypoints: 4}}
+	var route = testRoute(8)
+	checker.checkWaypointCount(&route, "rte[1]")
+	if len(route.RouteWaypoints) != 8 || len(checker.violations) != 1 || checker.violations[0].Fixed {
+		t.Errorf("route changed to %q with violations %v", waypointNames(route), checker.violations)
+	}
+}
+
+func TestCheckString(t *testing.T) {
+	for _, test := range []struct {
+		text       string
+		maxLength  int
+		multiline  bool
+		expected   string
+		violations int
+	}{
+		{"Hello World", 5, false, "Hello", 1},
+		// Spaces at the cut are removed
+		{"Ab cde", 3, false, "Ab", 1},
+		// Counted in characters, not bytes
+		{"Straße", 6, false, "Straße", 0},
+		{"Straße", 5, false, "Straß", 1},
+		// Unsupported characters and length at once
+		{"A😀\tB\nC", 4, false, "A B", 2},
+		{"A😀\tB\nC", 0, true, "A B\nC", 1},
+		{"Unchanged", 0, false, "Unchanged", 0},
+	} {
+		var checker = constraintChecker{fix: true}
+		var text = test.text
+		checker.checkString(&text, "name", test.maxLength, test.multiline)
+		if text != test.expected || len(checker.violations) != test.violations {
+			t.Errorf("%q fixed to %q with %d violations, expected %q with %d", test.text, text, len(checker.violations), test.expected, test.violations)
+		}
+	}
+}
+
+func TestCheckCoordinates(t *testing.T) {
+	var headUnit, err = HeadUnitByName("cic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gpxFile = gpx.GPX{Routes: []gpx.Route{{RouteWaypoints: []gpx.RouteWaypoint{{Latitude: 48.1234567891, Longitude: 11.000001}}}}}
+
+	// Planner precision is no violation, not even in strict mode
+	violations, err := CheckConstraints(&gpxFile, headUnit, false)
+	if err != nil || len(violations) != 0 {
+		t.Errorf("strict check reported %v, %v", violations, err)
+	}
+
+	violations, err = CheckConstraints(&gpxFile, headUnit, true)
+	var waypoint = gpxFile.Routes[0].RouteWaypoints[0]
+	if err != nil || len(violations) != 0 || waypoint.Latitude != 48.123457 || waypoint.Longitude != 11.000001 {
+		t.Errorf("coordinates fixed to %v, %v with %v, %v", waypoint.Latitude, waypoint.Longitude, violations, err)
+	}
+}
@@ -1,8 +1,9 @@
 package bmw
 
 import (
-	"encoding/xml"
+	"math"
 	"strconv"
+	"time"
 
 	"github.com/Organized92/route2bimmer/gpx"
 )
@@ -32,40 +33,50 @@ const conUnitDuration string = "h"
 const conTextDefault string = "-"
 const conRouteCostModel int = 2
 const conRouteCriteria int = 0
+const conCreationTimeFormat string = "2006-01-02T15:04:05"
 
 // NavFromGPX maps GPX data into the BMW format for "Nav" folder
-func NavFromGPX(gpx gpx.GPX, routeID int64) (DeliveryPackage, error) {
+func NavFromGPX(gpx gpx.GPX, routeID int64, options Options) (DeliveryPackage, error) {
 	var deliveryPackage DeliveryPackage
 	var err error
 
 	// Basic data
-	fillDeliveryPackage(&deliveryPackage, gpx, routeID)
+	fillDeliveryPackage(&deliveryPackage, gpx, routeID, options)
 
 	// Fill guided tour with data
-	deliveryPackage.GuidedTour, err = getGuidedToursNav(gpx, routeID)
+	options = withTrackMatches(gpx, options)
+	deliveryPackage.GuidedTour, err = getGuidedToursNav(gpx, routeID, options)
 
 	return deliveryPackage, err
 }
 
 // NavigationFromGPX maps GPX data into the BMW format for "Nav" folder
-func NavigationFromGPX(gpx gpx.GPX, routeID int64) (DeliveryPackage, error) {
+func NavigationFromGPX(gpx gpx.GPX, routeID int64, options Options) (DeliveryPackage, error) {
 	var deliveryPackage DeliveryPackage
 	var err error
 
 	// Basic data
-	fillDeliveryPackage(&deliveryPackage, gpx, routeID)
+	fillDeliveryPackage(&deliveryPackage, gpx, routeID, options)
 
 	// Fill guided tour with data
-	deliveryPackage.GuidedTour, err = getGuidedToursNavigation(gpx, routeID)
+	options = withTrackMatches(gpx, options)
+	deliveryPackage.GuidedTour, err = getGuidedToursNavigation(gpx, routeID, options)
 
 	return deliveryPackage, err
 }
 
-func fillDeliveryPackage(bmw *DeliveryPackage, gpx gpx.GPX, routeID int64) {
-	bmw.VersionNo = conVersionZeroDotZero
-	if gpx.Metadata.Time != "" {
-		bmw.CreationTime = gpx.Metadata.Time
+// withTrackMatches makes sure that the options contain the track of every route, so
+// that the tracks are matched only once
+func withTrackMatches(gpx gpx.GPX, options Options) Options {
+	if len(options.TrackMatches) != len(gpx.Routes) {
+		options.TrackMatches = gpx.MatchTracks()
 	}
+	return options
+}
+
+func fillDeliveryPackage(bmw *DeliveryPackage, gpx gpx.GPX, routeID int64, options Options) {
+	bmw.VersionNo = conVersionZeroDotZero
+	bmw.CreationTime = formatCreationTime(options.CreationTime, gpx)
 	bmw.MapVersion = conVersionZeroDotZero
 	bmw.LanguageCodeDesc = conLanguageCodeDesc
 	bmw.CountryCodeDesc = conCountryCodeDesc
@@ -80,7 +91,22 @@ func fillDeliveryPackage(bmw *DeliveryPackage, gpx gpx.GPX, routeID int64) {
 	bmw.MinorVersion = conMinorVersion
 }
 
-func getGuidedToursNav(gpx gpx.GPX, routeID int64) ([]GuidedTour, error) {
+// formatCreationTime formats the creation time the way the navigation system does it
+// in its own route files, in UTC and without time zone. If creationTime is not set,
+// the time from the metadata of the GPX file is used. If there is no valid time in
+// the metadata either, an empty string will be returned.
+func formatCreationTime(creationTime time.Time, gpx gpx.GPX) string {
+	if creationTime.IsZero() {
+		metadataTime, err := time.Parse(time.RFC3339, gpx.Metadata.Time)
+		if err != nil {
+			return ""
+		}
+		creationTime = metadataTime
+	}
+	return creationTime.UTC().Format(conCreationTimeFormat)
+}
+
+func getGuidedToursNav(gpx gpx.GPX, routeID int64, options Options) ([]GuidedTour, error) {
 	var guidedTours []GuidedTour
 	var guidedTour GuidedTour
 	var err error
@@ -95,37 +121,37 @@ func getGuidedToursNav(gpx gpx.GPX, routeID int64) ([]GuidedTour, error) {
 		return guidedTours, err
 	}
 
-	guidedTour.Names, err = getNames(gpx, routeID)
+	guidedTour.Names, err = getNames(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Length, err = getLength(gpx, routeID)
+	guidedTour.Length, err = getLength(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Duration, err = getDuration(gpx, routeID)
+	guidedTour.Duration, err = getDuration(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Introductions, err = getIntroductions(gpx, routeID)
+	guidedTour.Introductions, err = getIntroductions(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Descriptions, err = getDescriptions(gpx, routeID)
+	guidedTour.Descriptions, err = getDescriptions(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Pictures, err = getPictures(gpx, routeID)
+	guidedTour.Pictures, err = getPictures(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Routes, err = getRoutesNav(gpx, routeID)
+	guidedTour.Routes, err = getRoutesNav(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
@@ -139,7 +165,7 @@ func getGuidedToursNav(gpx gpx.GPX, routeID int64) ([]GuidedTour, error) {
 	return guidedTours, err
 }
 
-func getGuidedToursNavigation(gpx gpx.GPX, routeID int64) ([]GuidedTour, error) {
+func getGuidedToursNavigation(gpx gpx.GPX, routeID int64, options Options) ([]GuidedTour, error) {
 	var guidedTours []GuidedTour
 	var guidedTour GuidedTour
 	var err error
@@ -154,37 +180,37 @@ func getGuidedToursNavigation(gpx gpx.GPX, routeID int64) ([]GuidedTour, error)
 		return guidedTours, err
 	}
 
-	guidedTour.Names, err = getNames(gpx, routeID)
+	guidedTour.Names, err = getNames(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Length, err = getLength(gpx, routeID)
+	guidedTour.Length, err = getLength(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Duration, err = getDuration(gpx, routeID)
+	guidedTour.Duration, err = getDuration(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Introductions, err = getIntroductions(gpx, routeID)
+	guidedTour.Introductions, err = getIntroductions(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Descriptions, err = getDescriptions(gpx, routeID)
+	guidedTour.Descriptions, err = getDescriptions(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Pictures, err = getPictures(gpx, routeID)
+	guidedTour.Pictures, err = getPictures(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
 
-	guidedTour.Routes, err = getRoutesNavigation(gpx, routeID)
+	guidedTour.Routes, err = getRoutesNavigation(gpx, routeID, options)
 	if err != nil {
 		return guidedTours, err
 	}
@@ -211,78 +237,160 @@ func getCountries(gpx gpx.GPX, routeID int64) ([]Country, error) {
 	return countries, err
 }
 
-func getNames(gpx gpx.GPX, routeID int64) ([]TourName, error) {
+func getNames(gpx gpx.GPX, routeID int64, options Options) ([]TourName, error) {
 	var names []TourName
-	var name TourName
-	var err error
 
-	name.LanguageCode = conLanguageCodeEnglish
-	name.Text = gpx.GetName()
+	// The name is available in one or more languages
+	texts, err := localizedTexts(gpx.GetNames(options.Language), options)
+	if err != nil {
+		return names, err
+	}
+
+	for _, text := range texts {
+		var name TourName
+		name.LanguageCode = text.Language
+		name.Text = text.Value
+		names = append(names, name)
+	}
+
+	// Languages the navigation system does not know are left out above. The
+	// navigation system expects at least one name, so we fall back to the untranslated
+	// name in the default language.
+	if len(names) == 0 {
+		var name TourName
+		name.LanguageCode, err = LanguageCode(options.Language)
+		name.Text = gpx.GetName()
+		names = append(names, name)
+	}
 
-	names = append(names, name)
 	return names, err
 }
 
-func getLength(gpx gpx.GPX, routeID int64) (TourLength, error) {
+func getLength(gpx gpx.GPX, routeID int64, options Options) (TourLength, error) {
 	var length TourLength
 	var totalDistanceKm float64
 	var err error
 
 	length.Unit = conUnitDistance
-	for _, track := range gpx.Tracks {
-		totalDistanceKm = totalDistanceKm + float64(track.CalcTotalDistance())/1000
+
+	// The length of the tour is the sum of its routes, same as the duration. Without
+	// routes, we take the tracks instead.
+	for i, gpxRoute := range gpx.Routes {
+		routeLength, err := getRouteLength(gpxRoute, i, options)
+		if err != nil {
+			return length, err
+		}
+		totalDistanceKm = totalDistanceKm + routeLength.Value
+	}
+	if len(gpx.Routes) == 0 {
+		for _, track := range gpx.Tracks {
+			totalDistanceKm = totalDistanceKm + track.CalcDistance(options.Distance)/1000
+		}
 	}
 	length.Value = totalDistanceKm
 	return length, err
 }
 
-func getDuration(gpx gpx.GPX, routeID int64) (TourDuration, error) {
+func getDuration(gpx gpx.GPX, routeID int64, options Options) (TourDuration, error) {
 	var duration TourDuration
 	var totalDurationH float64
 	var err error
 
 	duration.Unit = conUnitDuration
-	for _, track := range gpx.Tracks {
-		partialDurationH, err := track.CalcTotalDuration()
+
+	// The duration of the tour is the sum of its routes. Without routes, we take the
+	// tracks instead.
+	for i, gpxRoute := range gpx.Routes {
+		routeDuration, err := getRouteDuration(gpxRoute, i, options)
 		if err != nil {
 			return duration, err
 		}
-		totalDurationH = totalDurationH + float64(partialDurationH)/3600
+		totalDurationH = totalDurationH + routeDuration.Value
+	}
+	if len(gpx.Routes) == 0 {
+		for _, track := range gpx.Tracks {
+			partialDurationS, err := track.CalcDuration(options.Duration)
+			if err != nil {
+				return duration, err
+			}
+			totalDurationH = totalDurationH + partialDurationS/3600
+		}
 	}
 	duration.Value = totalDurationH
 	return duration, err
 }
 
-func getIntroductions(gpx gpx.GPX, routeID int64) ([]TourIntroduction, error) {
+func getIntroductions(gpx gpx.GPX, routeID int64, options Options) ([]TourIntroduction, error) {
 	var introductions []TourIntroduction
-	var introduction TourIntroduction
-	var err error
 
-	introduction.LanguageCode = conLanguageCodeEnglish
-	introduction.Text = conTextDefault
+	// The description of the GPX file is the introduction of the tour
+	texts, err := localizedTexts(gpx.GetIntroductions(options.Language), options)
+	if err != nil {
+		return introductions, err
+	}
+
+	for _, text := range texts {
+		var introduction TourIntroduction
+		introduction.LanguageCode = text.Language
+		introduction.Text = text.Value
+		introductions = append(introductions, introduction)
+	}
+
+	// The navigation system expects at least one introduction
+	if len(introductions) == 0 {
+		var introduction TourIntroduction
+		introduction.LanguageCode, err = LanguageCode(options.Language)
+		introduction.Text = conTextDefault
+		if options.StatsTexts {
+			introduction.Text = fitText(StatsIntroduction(gpx.CalcStats(options.TrackMatches, options.Distance)), options)
+		}
+		introductions = append(introductions, introduction)
+	}
 
-	introductions = append(introductions, introduction)
 	return introductions, err
 }
 
-func getDescriptions(gpx gpx.GPX, routeID int64) ([]TourDescription, error) {
+func getDescriptions(gpx gpx.GPX, routeID int64, options Options) ([]TourDescription, error) {
 	var descriptions []TourDescription
-	var description TourDescription
-	var err error
 
-	description.LanguageCode = conLanguageCodeEnglish
-	description.Text = conTextDefault
+	// The descriptions of the routes are the description of the tour
+	texts, err := localizedTexts(gpx.GetDescriptions(options.Language), options)
+	if err != nil {
+		return descriptions, err
+	}
+
+	for _, text := range texts {
+		var description TourDescription
+		description.LanguageCode = text.Language
+		description.Text = text.Value
+		descriptions = append(descriptions, description)
+	}
+
+	// The navigation system expects at least one description
+	if len(descriptions) == 0 {
+		var description TourDescription
+		description.LanguageCode, err = LanguageCode(options.Language)
+		description.Text = conTextDefault
+		if options.StatsTexts {
+			description.Text = fitText(StatsDescription(gpx.CalcStats(options.TrackMatches, options.Distance)), options)
+		}
+		descriptions = append(descriptions, description)
+	}
 
-	descriptions = append(descriptions, description)
 	return descriptions, err
 }
 
-func getPictures(gpx gpx.GPX, routeID int64) ([]TourPicture, error) {
+func getPictures(gpx gpx.GPX, routeID int64, options Options) ([]TourPicture, error) {
 	var pictures []TourPicture
 	var picture TourPicture
 	var err error
 
-	picture.Reference = "routepicture_" + strconv.FormatInt(routeID, 10) + ".jpg"
+	// Pictures supplied by the caller
+	if len(options.Pictures) > 0 {
+		return options.Pictures, err
+	}
+
+	picture.Reference = PictureReference(routeID)
 	picture.Encoding = "JPEG"
 	picture.Width = 252
 	picture.Height = 172
@@ -291,12 +399,22 @@ func getPictures(gpx gpx.GPX, routeID int64) ([]TourPicture, error) {
 	return pictures, err
 }
 
-func getRoutesNav(gpx gpx.GPX, routeID int64) ([]Route, error) {
+// PictureReference returns the file name of the route picture
+func PictureReference(routeID int64) string {
+	return "routepicture_" + strconv.FormatInt(routeID, 10) + ".jpg"
+}
+
+// ProfileReference returns the file name of the elevation profile picture
+func ProfileReference(routeID int64) string {
+	return "routeprofile_" + strconv.FormatInt(routeID, 10) + ".jpg"
+}
+
+func getRoutesNav(gpx gpx.GPX, routeID int64, options Options) ([]Route, error) {
 	var routes []Route
 	var err error
 
 	// The GPX file may contain multiple routes. We have to loop over them
-	for _, gpxRoute := range gpx.Routes {
+	for i, gpxRoute := range gpx.Routes {
 		var route Route
 
 		route.RouteID = strconv.FormatInt(routeID, 10)
@@ -305,13 +423,19 @@ func getRoutesNav(gpx gpx.GPX, routeID int64) ([]Route, error) {
 		route.AgoraCString = ""
 
 		// Route length
-		route.Length, err = getRouteLength(gpx, gpxRoute)
+		route.Length, err = getRouteLength(gpxRoute, i, options)
 		if err != nil {
 			return routes, err
 		}
 
 		// Route duration
-		route.Duration, err = getRouteDuration(gpx, gpxRoute)
+		route.Duration, err = getRouteDuration(gpxRoute, i, options)
+		if err != nil {
+			return routes, err
+		}
+
+		// Legs between the waypoints
+		legs, err := getRouteLegs(gpx, gpxRoute, i, options)
 		if err != nil {
 			return routes, err
 		}
@@ -321,20 +445,19 @@ func getRoutesNav(gpx gpx.GPX, routeID int64) ([]Route, error) {
 			var waypoint RouteWayPoint
 			waypoint.ID = strconv.FormatInt(int64(rteWptIndex), 10)
 
-			// If this is the first or the last waypoint in the route,
-			// it has to be importance = always, otherwise optional
-			if rteWptIndex == 0 || rteWptIndex == len(gpxRoute.RouteWaypoints)-1 {
+			// If this is the first or the last waypoint in the route, or the
+			// car has to stop there, it has to be importance = always,
+			// otherwise optional
+			if gpxRoute.IsAlways(rteWptIndex) {
 				waypoint.Importance = conImportanceAlways
 			} else {
 				waypoint.Importance = conImportanceOptional
 			}
 
 			// Waypoint description
-			if gpxWaypoint.Description != "" {
-				var description TourDescription
-				description.LanguageCode = conLanguageCodeEnglish
-				description.Text = gpxWaypoint.Description
-				waypoint.Descriptions = append(waypoint.Descriptions, description)
+			waypoint.Descriptions, err = getWaypointDescriptions(gpxWaypoint, rteWptIndex, legs, options)
+			if err != nil {
+				return routes, err
 			}
 
 			// Location
@@ -342,14 +465,8 @@ func getRoutesNav(gpx gpx.GPX, routeID int64) ([]Route, error) {
 			location.GeoPosition.Latitude = gpxWaypoint.Latitude
 			location.GeoPosition.Longitude = gpxWaypoint.Longitude
 
-			// If this is a importance = always waypoint, we have to include
-			// address data to this location
-			if waypoint.Importance == conImportanceAlways {
-				var address WayPointAddress
-				address.ParsedAddress.ParsedStreetAddress.ParsedStreetName.StreetName = gpxWaypoint.Name
-				address.ParsedAddress.ParsedPlace.PlaceLevel4 = gpxWaypoint.Name
-				location.Address = &address
-			}
+			// Address data for this location
+			location.Address = getAddress(gpxWaypoint, waypoint.Importance)
 
 			waypoint.Locations = append(waypoint.Locations, location)
 
@@ -362,7 +479,7 @@ func getRoutesNav(gpx gpx.GPX, routeID int64) ([]Route, error) {
 	return routes, err
 }
 
-func getRoutesNavigation(gpx gpx.GPX, routeID int64) ([]Route, error) {
+func getRoutesNavigation(gpx gpx.GPX, routeID int64, options Options) ([]Route, error) {
 	var routes []Route
 	var err error
 
@@ -376,13 +493,19 @@ func getRoutesNavigation(gpx gpx.GPX, routeID int64) ([]Route, error) {
 		route.AgoraCString = ""
 
 		// Route length
-		route.Length, err = getRouteLength(gpx, gpxRoute)
+		route.Length, err = getRouteLength(gpxRoute, rteIndex, options)
 		if err != nil {
 			return routes, err
 		}
 
 		// Route duration
-		route.Duration, err = getRouteDuration(gpx, gpxRoute)
+		route.Duration, err = getRouteDuration(gpxRoute, rteIndex, options)
+		if err != nil {
+			return routes, err
+		}
+
+		// Legs between the waypoints
+		legs, err := getRouteLegs(gpx, gpxRoute, rteIndex, options)
 		if err != nil {
 			return routes, err
 		}
@@ -392,20 +515,19 @@ func getRoutesNavigation(gpx gpx.GPX, routeID int64) ([]Route, error) {
 			var waypoint RouteWayPoint
 			waypoint.ID = strconv.FormatInt(int64(rteIndex), 10) + "_" + strconv.FormatInt(int64(rteWptIndex), 10)
 
-			// If this is the first or the last waypoint in the route,
-			// it has to be importance = always, otherwise optional
-			if rteWptIndex == 0 || rteWptIndex == len(gpxRoute.RouteWaypoints)-1 {
+			// If this is the first or the last waypoint in the route, or the
+			// car has to stop there, it has to be importance = always,
+			// otherwise optional
+			if gpxRoute.IsAlways(rteWptIndex) {
 				waypoint.Importance = conImportanceAlways
 			} else {
 				waypoint.Importance = conImportanceOptional
 			}
 
 			// Waypoint description
-			if gpxWaypoint.Description != "" {
-				var description TourDescription
-				description.LanguageCode = conLanguageCodeEnglish
-				description.Text = gpxWaypoint.Description
-				waypoint.Descriptions = append(waypoint.Descriptions, description)
+			waypoint.Descriptions, err = getWaypointDescriptions(gpxWaypoint, rteWptIndex, legs, options)
+			if err != nil {
+				return routes, err
 			}
 
 			// Location
@@ -413,14 +535,8 @@ func getRoutesNavigation(gpx gpx.GPX, routeID int64) ([]Route, error) {
 			location.GeoPosition.Latitude = gpxWaypoint.Latitude
 			location.GeoPosition.Longitude = gpxWaypoint.Longitude
 
-			// If this is a importance = always waypoint, we have to include
-			// address data to this location
-			if waypoint.Importance == conImportanceAlways {
-				var address WayPointAddress
-				address.ParsedAddress.ParsedStreetAddress.ParsedStreetName.StreetName = gpxWaypoint.Name
-				address.ParsedAddress.ParsedPlace.PlaceLevel4 = gpxWaypoint.Name
-				location.Address = &address
-			}
+			// Address data for this location
+			location.Address = getAddress(gpxWaypoint, waypoint.Importance)
 
 			waypoint.Locations = append(waypoint.Locations, location)
 
@@ -453,69 +569,164 @@ func getEntryPoints(routes []Route, routeID int64) ([]EntryPoint, error) {
 	return entryPoints, err
 }
 
-func getRouteLength(gpx gpx.GPX, route gpx.Route) (TourLength, error) {
+// getAddress returns the address of a waypoint. Every waypoint with a known address
+// gets one. If this is a importance = always waypoint, we have to include address
+// data in any case, so we fall back to the name of the waypoint.
+func getAddress(gpxWaypoint gpx.RouteWaypoint, importance string) *WayPointAddress {
+	var gpxAddress = gpxWaypoint.GetAddress()
+
+	// No address known
+	if gpxAddress.IsEmpty() {
+		if importance != conImportanceAlways {
+			return nil
+		}
+		var address WayPointAddress
+		address.ParsedAddress.ParsedStreetAddress.ParsedStreetName.StreetName = gpxWaypoint.Name
+		address.ParsedAddress.ParsedPlace.PlaceLevel4 = gpxWaypoint.Name
+		return &address
+	}
+
+	var address WayPointAddress
+	address.ParsedAddress.ParsedStreetAddress.ParsedStreetName.StreetName = gpxAddress.Street
+	address.ParsedAddress.ParsedStreetAddress.HouseNumber = gpxAddress.HouseNumber
+	address.ParsedAddress.ParsedPlace.PlaceLevel1 = gpxAddress.Country
+	address.ParsedAddress.ParsedPlace.PlaceLevel2 = gpxAddress.State
+	address.ParsedAddress.ParsedPlace.PlaceLevel4 = gpxAddress.City
+	address.ParsedAddress.PostalCode = gpxAddress.PostalCode
+	return &address
+}
+
+func getRouteLength(route gpx.Route, routeIndex int, options Options) (TourLength, error) {
 	var length TourLength
 	var err error
 
 	length.Unit = conUnitDistance
-	// We have the track that corresponds to this route. If the GPX file
-	// contains only one track, we use this one. If it has more than one,
-	// we have to identify the correct track by name. This requires that
-	// route name and track name are equal.
-	if len(gpx.Tracks) == 1 {
-		length.Value = float64(gpx.Tracks[0].CalcTotalDistance()) / 1000
-	} else {
-		// More than one? Or no track at all?
-		if len(gpx.Tracks) > 1 {
-
-			// There is more than one track. We have to find the correct one.
-			for _, track := range gpx.Tracks {
-				if track.Name == route.Name {
-					length.Value = float64(track.CalcTotalDistance()) / 1000
-				}
-			}
-
-		} else {
-			// No track at all
-			length.Value = 0
-		}
-	}
+	// We need the track that corresponds to this route. It is found by comparing
+	// the geometry of the tracks with the waypoints of the route. If there is
+	// none, we use straight lines between the waypoints.
+	var track = getRouteTrack(route, routeIndex, options)
+	length.Value = track.CalcDistance(options.Distance) / 1000
 
 	return length, err
 }
 
-func getRouteDuration(gpx gpx.GPX, route gpx.Route) (TourDuration, error) {
+func getRouteDuration(route gpx.Route, routeIndex int, options Options) (TourDuration, error) {
 	var duration TourDuration
-	var calcDuration int64
+	var calcDuration float64
 	var err error
 
+	// The average speed can be set for each route
+	var durationOptions = getDurationOptions(routeIndex, options)
+
 	duration.Unit = conUnitDuration
-	// We have the track that corresponds to this route. If the GPX file
-	// contains only one track, we use this one. If it has more than one,
-	// we have to identify the correct track by name. This requires that
-	// route name and track name are equal.
-	if len(gpx.Tracks) == 1 {
-		calcDuration, err = gpx.Tracks[0].CalcTotalDuration()
-		duration.Value = float64(calcDuration) / 3600
-	} else {
-		// More than one? Or no track at all?
-		if len(gpx.Tracks) > 1 {
-
-			// There is more than one track. We have to find the correct one.
-			for _, track := range gpx.Tracks {
-				if track.Name == route.Name {
-					calcDuration, err = track.CalcTotalDuration()
-					duration.Value = float64(calcDuration) / 3600
-				}
-			}
+	// Same track as for the length. Without a track, the duration is estimated
+	// along the straight lines between the waypoints.
+	var track = getRouteTrack(route, routeIndex, options)
+	calcDuration, err = track.CalcDuration(durationOptions)
+	duration.Value = calcDuration / 3600
+
+	return duration, err
+}
+
+// getDurationOptions returns the options to calculate the duration of a route,
+// including the average speed set for this route
+func getDurationOptions(routeIndex int, options Options) gpx.DurationOptions {
+	var durationOptions = options.Duration
+	if routeIndex < len(options.RouteSpeeds) && options.RouteSpeeds[routeIndex] > 0 {
+		durationOptions.AverageSpeed = options.RouteSpeeds[routeIndex]
+	}
+	return durationOptions
+}
+
+// getRouteLegs returns the legs between the waypoints of the route, if they are
+// needed for the waypoint descriptions
+func getRouteLegs(gpx gpx.GPX, route gpx.Route, routeIndex int, options Options) ([]gpx.Leg, error) {
+	if !options.LegDescriptions {
+		return nil, nil
+	}
+	return gpx.CalcLegs(route, options.TrackMatches[routeIndex], getDurationOptions(routeIndex, options))
+}
+
+// getWaypointDescriptions returns the description of a waypoint. If legs are given,
+// distance and duration of the leg ending at this waypoint are added.
+func getWaypointDescriptions(gpxWaypoint gpx.RouteWaypoint, waypointIndex int, legs []gpx.Leg, options Options) ([]TourDescription, error) {
+	var descriptions []TourDescription
+	var err error
 
+	var text = gpxWaypoint.Description
+	if waypointIndex > 0 && waypointIndex <= len(legs) {
+		var legText = LegDescription(waypointIndex, legs[waypointIndex-1])
+		if text == "" {
+			text = legText
 		} else {
-			// No track at all
-			duration.Value = 0
+			text = text + "\n" + legText
 		}
+		text = fitText(text, options)
+	}
+	if text == "" {
+		return descriptions, err
 	}
 
-	return duration, err
+	var description TourDescription
+	description.LanguageCode, err = LanguageCode(options.Language)
+	if err != nil {
+		return descriptions, err
+	}
+	description.Text = text
+	descriptions = append(descriptions, description)
+
+	return descriptions, err
+}
+
+// LegDescription describes distance and duration of a leg, e.g. "Leg 3: 42 km, 0:55 h"
+func LegDescription(number int, leg gpx.Leg) string {
+	return "Leg " + strconv.Itoa(number) + ": " + DistanceText(leg.Distance) + ", " + DurationText(leg.Duration)
+}
+
+// DistanceText formats a distance in meters as kilometers, e.g. "42 km" or "4.2 km"
+func DistanceText(distance float64) string {
+	if distance < 10000 {
+		return strconv.FormatFloat(distance/1000, 'f', 1, 64) + " km"
+	}
+	return strconv.FormatFloat(math.Round(distance/1000), 'f', 0, 64) + " km"
+}
+
+// DurationText formats a duration in seconds as hours and minutes, e.g. "0:55 h"
+func DurationText(duration float64) string {
+	var minutes = int64(math.Round(duration / 60))
+	return strconv.FormatInt(minutes/60, 10) + ":" + strconv.FormatInt(minutes%60/10, 10) + strconv.FormatInt(minutes%10, 10) + " h"
+}
+
+// StatsIntroduction describes length and elevations of a tour, e.g. "Length 74 km,
+// ascent 1250 m, descent 1230 m, highest point 1850 m"
+func StatsIntroduction(stats gpx.Stats) string {
+	var text = "Length " + DistanceText(stats.Distance)
+	if stats.HasElevation {
+		text = text + ", ascent " + elevationText(stats.Ascent) + ", descent " + elevationText(stats.Descent) + ", highest point " + elevationText(stats.HighestPoint.Elevation)
+	}
+	return text
+}
+
+// StatsDescription describes the curves and gradients of a tour, e.g. "12 hairpins,
+// twistiness 85°/km, 40 % straight, max. gradient 12 %"
+func StatsDescription(stats gpx.Stats) string {
+	var text = strconv.Itoa(stats.Hairpins) + " hairpins, twistiness " + strconv.FormatFloat(stats.Twistiness, 'f', 0, 64) + "°/km, " + strconv.FormatFloat(stats.StraightShare*100, 'f', 0, 64) + " % straight"
+	if stats.HasElevation {
+		text = text + ", max. gradient " + strconv.FormatFloat(stats.MaxGradient, 'f', 0, 64) + " %"
+	}
+	return text
+}
+
+// elevationText formats an elevation in meters, e.g. "1850 m"
+func elevationText(elevation float64) string {
+	return strconv.FormatFloat(elevation, 'f', 0, 64) + " m"
+}
+
+// getRouteTrack returns the section of the track which belongs to the route, or
+// straight lines between the waypoints if no track matches
+func getRouteTrack(route gpx.Route, routeIndex int, options Options) gpx.Track {
+	var track, _ = options.TrackMatches[routeIndex].Path(route)
+	return track
 }
 
 //
@@ -663,9 +874,3 @@ func getRouteDuration(gpx gpx.GPX, route gpx.Route) (TourDuration, error) {
 // 	return deliveryPackage, err
 // }
 //
-
-// ToXML converts the BMW structure to some real xml Text
-func (bmw DeliveryPackage) ToXML() ([]byte, error) {
-	buffer, err := xml.MarshalIndent(bmw, "", "  ")
-	return buffer, err
-}
@@ -0,0 +1,36 @@
+package bmw
+
+import (
+	"errors"
+	"strings"
+)
+
+// headUnits contains all navigation systems route2bimmer is able to create routes for.
+// BMW does not publish the limits of the route import, so these are conservative
+// assumptions rather than measured maxima: a route within them should be accepted,
+// a larger one may work as well. Raise them once a larger route has been tested in a
+// car, or use --constraints=off. The coordinates are written with 6 decimal places
+// into the route files (see WayPointGeoPosition), so that is what they are rounded to.
+var headUnits = []HeadUnit{
+	{Name: "nbtevo", MaxWaypoints: 100, MaxNameLength: 64, MaxTextLength: 1000, CoordinateDecimals: 6},
+	{Name: "cic", MaxWaypoints: 30, MaxNameLength: 40, MaxTextLength: 500, CoordinateDecimals: 6},
+}
+
+// HeadUnitByName returns the navigation system with the given name, e.g. "nbtevo"
+func HeadUnitByName(name string) (HeadUnit, error) {
+	for _, headUnit := range headUnits {
+		if strings.EqualFold(headUnit.Name, name) {
+			return headUnit, nil
+		}
+	}
+	return HeadUnit{}, errors.New("unknown head unit \"" + name + "\", known are: " + strings.Join(HeadUnitNames(), ", "))
+}
+
+// HeadUnitNames returns the names of all known navigation systems
+func HeadUnitNames() []string {
+	var names []string
+	for _, headUnit := range headUnits {
+		names = append(names, headUnit.Name)
+	}
+	return names
+}
@@ -0,0 +1,59 @@
+package bmw
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Organized92/route2bimmer/gpx"
+)
+
+// LanguageCode converts an ISO 639-1 or ISO 639-2 language code into the
+// three-letter code used by BMW. Region subtags like in "de-AT" are ignored.
+func LanguageCode(code string) (string, error) {
+	// BMW uses the upper case bibliographic code in its route files, e.g. "ENG" or "GER"
+	if language, ok := gpx.FindLanguage(code); ok {
+		return strings.ToUpper(language.Bibliographic), nil
+	}
+
+	return "", errors.New("unknown language code \"" + code + "\"")
+}
+
+// localizedTexts converts the texts read from the GPX file into BMW language codes.
+// Texts in unknown languages are skipped, as well as texts in a language which is
+// already present. The text in the default language of the options comes first.
+func localizedTexts(texts []gpx.LocalizedText, options Options) ([]gpx.LocalizedText, error) {
+	var result []gpx.LocalizedText
+
+	defaultCode, err := LanguageCode(options.Language)
+	if err != nil {
+		return result, err
+	}
+
+	for _, text := range texts {
+		code, err := LanguageCode(text.Language)
+		if err != nil {
+			continue
+		}
+
+		var found = false
+		for _, existing := range result {
+			if existing.Language == code {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		// The default language always comes first
+		text.Language = code
+		if code == defaultCode {
+			result = append([]gpx.LocalizedText{text}, result...)
+		} else {
+			result = append(result, text)
+		}
+	}
+
+	return result, nil
+}
@@ -1,6 +1,85 @@
 package bmw
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/Organized92/route2bimmer/gpx"
+)
+
+// Options controls how the GPX data is mapped into the BMW format
+type Options struct {
+	// Language is the ISO 639-1 or ISO 639-2 code of the language used for texts
+	// in the GPX file which are not tagged with a language
+	Language string
+
+	// CreationTime is the creation time of the route. If it is not set, the time
+	// from the metadata of the GPX file will be used.
+	CreationTime time.Time
+
+	// Pictures describes the pictures packaged together with the route. If it is
+	// empty, a single default route picture is assumed.
+	Pictures []TourPicture
+
+	// Distance controls how the length of the tracks is calculated
+	Distance gpx.DistanceOptions
+
+	// Duration controls how the duration of the tracks is calculated
+	Duration gpx.DurationOptions
+
+	// RouteSpeeds contains the average speed in km/h for each route of the GPX
+	// file, overriding Duration. Routes without speed or with speed 0 use Duration.
+	RouteSpeeds []float64
+
+	// LegDescriptions adds distance and duration of the leg ending at a waypoint
+	// to the description of the waypoint
+	LegDescriptions bool
+
+	// StatsTexts uses statistics about the routes as introduction and description
+	// of the tour, if the GPX file does not contain any
+	StatsTexts bool
+
+	// TrackMatches contains the track of every route, as returned by
+	// gpx.MatchTracks. If it does not fit the routes, the tracks are matched again.
+	TrackMatches []gpx.TrackMatch
+
+	// HeadUnit the texts created by route2bimmer (leg and statistics texts) are
+	// fitted to, see CheckConstraints. If nil, they are left as they are.
+	HeadUnit *HeadUnit
+}
+
+// HeadUnit contains the properties of a BMW navigation system. A limit of 0 means
+// that it is unknown and not checked.
+type HeadUnit struct {
+	Name        string
+	MaxPictures int
+
+	// Limits of the route data, see CheckConstraints
+	MaxWaypoints       int
+	MaxNameLength      int
+	MaxTextLength      int
+	CoordinateDecimals int
+}
+
+// Violation describes an element of the GPX file which breaks a limit of the
+// navigation system
+type Violation struct {
+	// Element is the path of the GPX element, e.g. "rte[1]/rtept[3]/name"
+	Element string
+
+	// Rule describes the broken limit
+	Rule string
+
+	// Fixed tells if the element has been changed to comply with the limit
+	Fixed bool
+}
+
+// ConstraintError is returned if the GPX file breaks limits of the navigation
+// system which have not been fixed
+type ConstraintError struct {
+	HeadUnit   string
+	Violations []Violation
+}
 
 // DeliveryPackage is the root node of the BMW route format
 type DeliveryPackage struct {
@@ -65,14 +144,14 @@ type TourName struct {
 type TourLength struct {
 	XMLName xml.Name `xml:"Length"`
 	Unit    string   `xml:"Unit,attr"`
-	Value   float64  `xml:",chardata"`
+	Value   float64  `xml:",chardata" precision:"3"`
 }
 
 // TourDuration contains the driving duration and a unit of this tour
 type TourDuration struct {
 	XMLName xml.Name `xml:"Duration"`
 	Unit    string   `xml:"Unit,attr"`
-	Value   float64  `xml:",chardata"`
+	Value   float64  `xml:",chardata" precision:"2"`
 }
 
 // TourIntroduction contains information about introductions?
@@ -144,12 +223,14 @@ type ParsedAddress struct {
 	XMLName             xml.Name            `xml:"ParsedAddress"`
 	ParsedStreetAddress ParsedStreetAddress `xml:"ParsedStreetAddress"`
 	ParsedPlace         ParsedPlace         `xml:"ParsedPlace"`
+	PostalCode          string              `xml:"PostalCode,omitempty"`
 }
 
 // ParsedStreetAddress contains parsed street address data
 type ParsedStreetAddress struct {
 	XMLName          xml.Name         `xml:"ParsedStreetAddress"`
 	ParsedStreetName ParsedStreetName `xml:"ParsedStreetName"`
+	HouseNumber      string           `xml:"HouseNumber,omitempty"`
 }
 
 // ParsedStreetName contains a parsed street name
@@ -158,15 +239,18 @@ type ParsedStreetName struct {
 	StreetName string   `xml:"StreetName"`
 }
 
-// ParsedPlace contains a parsed place information
+// ParsedPlace contains a parsed place information. The levels go from the
+// country (level 1) down to the city (level 4).
 type ParsedPlace struct {
 	XMLName     xml.Name `xml:"ParsedPlace"`
+	PlaceLevel1 string   `xml:"PlaceLevel1,omitempty"`
+	PlaceLevel2 string   `xml:"PlaceLevel2,omitempty"`
 	PlaceLevel4 string   `xml:"PlaceLevel4"`
 }
 
 // WayPointGeoPosition contains information about the geographical position
 type WayPointGeoPosition struct {
 	XMLName   xml.Name `xml:"GeoPosition"`
-	Latitude  float64  `xml:"Latitude"`
-	Longitude float64  `xml:"Longitude"`
+	Latitude  float64  `xml:"Latitude" precision:"6"`
+	Longitude float64  `xml:"Longitude" precision:"6"`
 }
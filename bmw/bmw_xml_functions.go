@@ -0,0 +1,300 @@
+package bmw
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Layout of the XML files as written by the navigation system itself
+const conXMLDeclaration string = `<?xml version="1.0" encoding="UTF-8"?>`
+const conXMLIndent string = "  "
+const conXMLLineEnding string = "\n"
+
+// xmlField describes how a struct field is written, as given by its struct tags
+type xmlField struct {
+	name      string
+	parents   []string
+	attr      bool
+	chardata  bool
+	omitempty bool
+	precision int
+}
+
+// xmlWriter writes XML in the layout of the files created by the navigation system.
+// Every element starts on a new line, indented by two spaces per level. Elements
+// containing text are written on a single line, so are empty elements. Only the
+// elements given in split are written as start tag and an end tag on the following
+// line, indented as if the element had children.
+type xmlWriter struct {
+	buffer bytes.Buffer
+	split  map[string]bool
+	// the last thing written was a start tag, its line has not been ended yet
+	open bool
+}
+
+// ToXML converts the BMW structure to XML text, in the same layout the navigation
+// system uses for the routes it creates. Empty elements are written on one line,
+// except for the elements named in splitEmpty: the car writes these with the end tag
+// on the next line (e.g. AgoraCString in the folder "Nav").
+func (bmw DeliveryPackage) ToXML(splitEmpty ...string) ([]byte, error) {
+	var writer xmlWriter
+	var err error
+
+	writer.split = make(map[string]bool)
+	for _, name := range splitEmpty {
+		writer.split[name] = true
+	}
+
+	writer.buffer.WriteString(conXMLDeclaration + conXMLLineEnding)
+	err = writer.writeElement(reflect.ValueOf(bmw), "", -1, 0)
+
+	return writer.buffer.Bytes(), err
+}
+
+// writeElement writes a struct or a simple value as element. If no name is given,
+// the name is taken from the XMLName field of the struct. The precision is used for
+// simple floating point values.
+func (writer *xmlWriter) writeElement(value reflect.Value, name string, precision int, depth int) error {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	// Simple values contain nothing but text
+	if value.Kind() != reflect.Struct {
+		text, err := formatXMLValue(value, precision)
+		if err != nil {
+			return err
+		}
+		writer.writeText(name, nil, text, depth)
+		return nil
+	}
+
+	// Element name
+	var valueType = value.Type()
+	if name == "" {
+		if field, ok := valueType.FieldByName("XMLName"); ok {
+			name = parseXMLField(field).name
+		}
+	}
+	if name == "" {
+		return errors.New("no XML element name for " + valueType.Name())
+	}
+
+	// Sort the fields into attributes, text and child elements
+	var attrs []string
+	var text string
+	var hasText bool
+	var children []int
+	for i := 0; i < valueType.NumField(); i++ {
+		var field = parseXMLField(valueType.Field(i))
+		if valueType.Field(i).Name == "XMLName" || field.name == "-" {
+			continue
+		}
+		switch {
+		case field.attr:
+			attrValue, err := formatXMLValue(value.Field(i), field.precision)
+			if err != nil {
+				return err
+			}
+			if field.omitempty && attrValue == "" {
+				continue
+			}
+			attrs = append(attrs, field.name+"=\""+escapeXML(attrValue, true)+"\"")
+		case field.chardata:
+			fieldText, err := formatXMLValue(value.Field(i), field.precision)
+			if err != nil {
+				return err
+			}
+			text = text + fieldText
+			hasText = true
+		default:
+			children = append(children, i)
+		}
+	}
+
+	// Elements containing text are written on a single line
+	if hasText {
+		writer.writeText(name, attrs, text, depth)
+		return nil
+	}
+
+	// Child elements, the ones with a path like "Names>Name" are grouped in a parent
+	// element
+	writer.writeStart(name, attrs, depth)
+	for _, i := range children {
+		var field = parseXMLField(valueType.Field(i))
+		var fieldValue = value.Field(i)
+		if field.omitempty && isEmptyXMLValue(fieldValue) {
+			continue
+		}
+
+		var childDepth = depth + 1
+		for _, parent := range field.parents {
+			writer.writeStart(parent, nil, childDepth)
+			childDepth++
+		}
+
+		// Lists are written as one element per entry
+		if fieldValue.Kind() == reflect.Slice && fieldValue.Type().Elem().Kind() != reflect.Uint8 {
+			for j := 0; j < fieldValue.Len(); j++ {
+				err := writer.writeElement(fieldValue.Index(j), field.name, field.precision, childDepth)
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			err := writer.writeElement(fieldValue, field.name, field.precision, childDepth)
+			if err != nil {
+				return err
+			}
+		}
+
+		for j := len(field.parents) - 1; j >= 0; j-- {
+			childDepth--
+			writer.writeEnd(field.parents[j], childDepth)
+		}
+	}
+	writer.writeEnd(name, depth)
+
+	return nil
+}
+
+// writeText writes an element containing only text on a single line
+func (writer *xmlWriter) writeText(name string, attrs []string, text string, depth int) {
+	if text == "" {
+		writer.writeStart(name, attrs, depth)
+		writer.writeEnd(name, depth)
+		return
+	}
+	writer.endLine()
+	writer.buffer.WriteString(strings.Repeat(conXMLIndent, depth) + startTag(name, attrs))
+	writer.buffer.WriteString(escapeXML(text, false))
+	writer.buffer.WriteString("</" + name + ">" + conXMLLineEnding)
+	writer.open = false
+}
+
+// writeStart writes the start tag of an element on a new line. The line is ended
+// when the next thing is written, so that an empty element can stay on one line.
+func (writer *xmlWriter) writeStart(name string, attrs []string, depth int) {
+	writer.endLine()
+	writer.buffer.WriteString(strings.Repeat(conXMLIndent, depth) + startTag(name, attrs))
+	writer.open = true
+}
+
+// writeEnd writes the end tag of an element on a new line. Empty elements are closed
+// on the line of their start tag, unless they are to be split: then the end tag is
+// indented like a child element, as the navigation system does it.
+func (writer *xmlWriter) writeEnd(name string, depth int) {
+	if writer.open && !writer.split[name] {
+		writer.buffer.WriteString("</" + name + ">" + conXMLLineEnding)
+		writer.open = false
+		return
+	}
+	if writer.open {
+		depth++
+	}
+	writer.endLine()
+	writer.buffer.WriteString(strings.Repeat(conXMLIndent, depth) + "</" + name + ">" + conXMLLineEnding)
+}
+
+// endLine ends the line of a start tag, if it has not been ended yet
+func (writer *xmlWriter) endLine() {
+	if writer.open {
+		writer.buffer.WriteString(conXMLLineEnding)
+		writer.open = false
+	}
+}
+
+// startTag returns the start tag of an element with its attributes
+func startTag(name string, attrs []string) string {
+	if len(attrs) == 0 {
+		return "<" + name + ">"
+	}
+	return "<" + name + " " + strings.Join(attrs, " ") + ">"
+}
+
+// parseXMLField reads the xml and precision struct tags of a field. The precision
+// tag sets the number of decimal places of floating point numbers.
+func parseXMLField(field reflect.StructField) xmlField {
+	var result xmlField
+	var options = strings.Split(field.Tag.Get("xml"), ",")
+
+	result.name = options[0]
+	if result.name == "" {
+		result.name = field.Name
+	}
+	for _, option := range options[1:] {
+		switch option {
+		case "attr":
+			result.attr = true
+		case "chardata":
+			result.chardata = true
+		case "omitempty":
+			result.omitempty = true
+		}
+	}
+
+	// Path like "Names>Name"
+	var path = strings.Split(result.name, ">")
+	result.name = path[len(path)-1]
+	result.parents = path[:len(path)-1]
+
+	result.precision = -1
+	if precision, err := strconv.Atoi(field.Tag.Get("precision")); err == nil {
+		result.precision = precision
+	}
+
+	return result
+}
+
+// formatXMLValue converts a simple value into text. Floating point numbers are
+// written with the given number of decimal places, or as short as possible if the
+// precision is negative.
+func formatXMLValue(value reflect.Value, precision int) (string, error) {
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', precision, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	}
+	return "", errors.New("cannot write " + value.Type().String() + " as XML text")
+}
+
+// isEmptyXMLValue reports whether a value is left out because of omitempty
+func isEmptyXMLValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	case reflect.Slice, reflect.Map, reflect.String:
+		return value.Len() == 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	}
+	return false
+}
+
+// escapeXML replaces the characters which have a special meaning in XML. Line breaks
+// are kept in text, but not in attributes.
+func escapeXML(text string, attr bool) string {
+	var replacements = []string{"&", "&amp;", "<", "&lt;", ">", "&gt;"}
+	if attr {
+		replacements = append(replacements, "\"", "&quot;", "\n", "&#10;", "\r", "&#13;", "\t", "&#9;")
+	}
+	return strings.NewReplacer(replacements...).Replace(text)
+}
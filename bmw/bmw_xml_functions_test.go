@@ -0,0 +1,112 @@
+package bmw
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Organized92/route2bimmer/gpx"
+)
+
+// The golden files have the layout of the route files written by the navigation
+// system: XML declaration, two spaces indentation, "\n" line endings, empty elements
+// on one line and AgoraCString split over two lines in the folder "Nav"
+const conTestRoute string = "testdata/route.gpx"
+const conTestRouteID int64 = 1234567
+
+// testPackages converts the test route into both BMW layouts
+func testPackages(t *testing.T) (DeliveryPackage, DeliveryPackage) {
+	var path = conTestRoute
+	gpxFile, err := gpx.FromFile(&path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var options = Options{Language: "en", CreationTime: time.Date(2020, 6, 1, 8, 0, 0, 0, time.UTC)}
+	options.Duration.AverageSpeed = 40
+
+	nav, err := NavFromGPX(gpxFile, conTestRouteID, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	navigation, err := NavigationFromGPX(gpxFile, conTestRouteID, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nav, navigation
+}
+
+// compareGolden compares XML text with a golden file line by line, so that a
+// difference is easy to find
+func compareGolden(t *testing.T, data []byte, goldenFile string) {
+	golden, err := ioutil.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(data, golden) {
+		return
+	}
+
+	var lines = strings.Split(string(data), "\n")
+	var goldenLines = strings.Split(string(golden), "\n")
+	for i := 0; i < len(lines) || i < len(goldenLines); i++ {
+		var line, goldenLine string
+		if i < len(lines) {
+			line = lines[i]
+		}
+		if i < len(goldenLines) {
+			goldenLine = goldenLines[i]
+		}
+		if line != goldenLine {
+			t.Errorf("%s differs in line %d:\n got:  %q\n want: %q", goldenFile, i+1, line, goldenLine)
+			return
+		}
+	}
+}
+
+func TestToXMLNav(t *testing.T) {
+	nav, _ := testPackages(t)
+	data, err := nav.ToXML("AgoraCString")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, data, "testdata/nav.xml")
+}
+
+func TestToXMLNavigation(t *testing.T) {
+	_, navigation := testPackages(t)
+	data, err := navigation.ToXML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, data, "testdata/navigation.xml")
+}
+
+func TestToXMLElements(t *testing.T) {
+	var bmw DeliveryPackage
+	bmw.VersionNo = "0.0"
+	bmw.GuidedTour = []GuidedTour{{
+		TripType: "ROUTE",
+		Length:   TourLength{Unit: "KM", Value: 12.3456789},
+		Routes:   []Route{{}},
+	}}
+
+	data, err := bmw.ToXML("AgoraCString")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text = string(data)
+	for _, expected := range []string{
+		"<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<DeliveryPackage VersionNo=\"0.0\"",
+		"\n        <AgoraCString>\n          </AgoraCString>\n",
+		"\n    <Length Unit=\"KM\">12.346</Length>\n",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("%q not found in:\n%s", expected, text)
+		}
+	}
+	if strings.Contains(text, "\r") || strings.Contains(text, "\t") {
+		t.Errorf("unexpected line ending or indentation in:\n%s", text)
+	}
+}
@@ -0,0 +1,164 @@
+package elevation
+
+import (
+	"errors"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/Organized92/route2bimmer/gpx"
+)
+
+// FromDirectory returns an elevation provider for the SRTM tiles (.hgt or .hgt.zip
+// files, e.g. N48E011.hgt) in the supplied directory. The tiles are read when they
+// are needed.
+func FromDirectory(directory string) (*Provider, error) {
+	var provider *Provider
+	var err error
+
+	info, err := os.Stat(directory)
+	if err != nil {
+		return provider, err
+	}
+	if !info.IsDir() {
+		return provider, errors.New(directory + " is not a directory")
+	}
+
+	provider = &Provider{directory: directory, tiles: make(map[string]*tile)}
+	return provider, err
+}
+
+// Lookup returns the elevation in meters at a coordinate, interpolated between the
+// four surrounding samples. The second return value is false if the tile is missing
+// or the samples are voids.
+func (provider *Provider) Lookup(latitude float64, longitude float64) (float64, bool, error) {
+	tile, err := provider.tile(latitude, longitude)
+	if err != nil || tile == nil {
+		return 0, false, err
+	}
+
+	// Position within the tile in samples, row 0 is the northern edge
+	var row = (float64(tile.latitude+1) - latitude) * float64(tile.size-1)
+	var column = (longitude - float64(tile.longitude)) * float64(tile.size-1)
+	var row0 = int(math.Min(math.Floor(row), float64(tile.size-2)))
+	var column0 = int(math.Min(math.Floor(column), float64(tile.size-2)))
+	var rowFraction = row - float64(row0)
+	var columnFraction = column - float64(column0)
+
+	// Bilinear interpolation, leaving out voids
+	var sum, weights float64
+	for _, corner := range []struct {
+		row    int
+		column int
+		weight float64
+	}{
+		{row0, column0, (1 - rowFraction) * (1 - columnFraction)},
+		{row0, column0 + 1, (1 - rowFraction) * columnFraction},
+		{row0 + 1, column0, rowFraction * (1 - columnFraction)},
+		{row0 + 1, column0 + 1, rowFraction * columnFraction},
+	} {
+		var sample = tile.samples[corner.row*tile.size+corner.column]
+		if sample == conVoid || corner.weight == 0 {
+			continue
+		}
+		sum = sum + float64(sample)*corner.weight
+		weights = weights + corner.weight
+	}
+	if weights == 0 {
+		return 0, false, err
+	}
+
+	return sum / weights, true, err
+}
+
+// FillElevations sets the elevation of all points of tracks and routes without an
+// <ele> in the GPX file. Tracks and routes where all elevations are 0 are treated as
+// having no elevation data at all, as some route planners write 0 instead of leaving
+// it out. Returns the number of points whose elevation has been set and the names of
+// the tiles which are missing in the directory.
+func (provider *Provider) FillElevations(gpxFile *gpx.GPX) (int, []string, error) {
+	var filled int
+	var missing = make(map[string]bool)
+	var err error
+
+	// lookup sets a single elevation
+	var lookup = func(latitude float64, longitude float64, elevation *float64, hasElevation *bool) error {
+		value, found, err := provider.Lookup(latitude, longitude)
+		if err != nil {
+			return err
+		}
+		if !found {
+			missing[tileName(latitude, longitude)] = true
+			return nil
+		}
+		*elevation = value
+		*hasElevation = true
+		filled++
+		return nil
+	}
+
+	// Loop over the tracks
+	for t := range gpxFile.Tracks {
+		var track = &gpxFile.Tracks[t]
+		var allZero = !hasTrackElevations(*track)
+		for s := range track.Segments {
+			for p := range track.Segments[s].Points {
+				var point = &track.Segments[s].Points[p]
+				if point.HasElevation && !allZero {
+					continue
+				}
+				if err = lookup(point.Latitude, point.Longitude, &point.Elevation, &point.HasElevation); err != nil {
+					return filled, nil, err
+				}
+			}
+		}
+	}
+
+	// Loop over the routes
+	for r := range gpxFile.Routes {
+		var route = &gpxFile.Routes[r]
+		var allZero = !hasRouteElevations(*route)
+		for w := range route.RouteWaypoints {
+			var waypoint = &route.RouteWaypoints[w]
+			if waypoint.HasElevation && !allZero {
+				continue
+			}
+			if err = lookup(waypoint.Latitude, waypoint.Longitude, &waypoint.Elevation, &waypoint.HasElevation); err != nil {
+				return filled, nil, err
+			}
+		}
+	}
+
+	// Tiles which have been found but only contain voids are not missing
+	var missingTiles []string
+	for name := range missing {
+		if provider.tiles[name] == nil {
+			missingTiles = append(missingTiles, name)
+		}
+	}
+	sort.Strings(missingTiles)
+
+	return filled, missingTiles, err
+}
+
+// hasTrackElevations tells if any point of the track has an elevation
+func hasTrackElevations(track gpx.Track) bool {
+	for _, segment := range track.Segments {
+		for _, point := range segment.Points {
+			if point.Elevation != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasRouteElevations tells if any waypoint of the route has an elevation
+func hasRouteElevations(route gpx.Route) bool {
+	for _, waypoint := range route.RouteWaypoints {
+		if waypoint.Elevation != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package elevation
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/Organized92/route2bimmer/gpx"
+)
+
+// writeTestTile writes a 3 x 3 tile N48E011.hgt, so the samples are half a degree
+// apart. The sample in the south west corner is a void.
+func writeTestTile(t *testing.T) string {
+	var directory = t.TempDir()
+	var samples = []int16{
+		100, 200, 300,
+		400, 500, 600,
+		conVoid, 800, 900,
+	}
+	var data = make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		binary.BigEndian.PutUint16(data[2*i:], uint16(sample))
+	}
+	if err := ioutil.WriteFile(filepath.Join(directory, "N48E011.hgt"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return directory
+}
+
+func TestLookup(t *testing.T) {
+	provider, err := FromDirectory(writeTestTile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		latitude  float64
+		longitude float64
+		elevation float64
+	}{
+		// Samples
+		{48.5, 11, 400},
+		{48.5, 11.5, 500},
+		// Between samples
+		{48.75, 11.25, 300},
+		{48.5, 11.75, 550},
+		{48.875, 11.5, 275},
+		// Next to a void, which is left out
+		{48.25, 11.25, (400 + 500 + 800) / 3.0},
+	} {
+		elevation, ok, err := provider.Lookup(test.latitude, test.longitude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || math.Abs(elevation-test.elevation) > 1e-9 {
+			t.Errorf("elevation at %v, %v is %v (%v), expected %v", test.latitude, test.longitude, elevation, ok, test.elevation)
+		}
+	}
+}
+
+func TestLookupVoid(t *testing.T) {
+	provider, err := FromDirectory(writeTestTile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Exactly on the void
+	if elevation, ok, err := provider.Lookup(48, 11); ok || err != nil {
+		t.Errorf("elevation on a void is %v (%v, %v), expected none", elevation, ok, err)
+	}
+
+	// Tile missing in the directory
+	if elevation, ok, err := provider.Lookup(50.5, 11.5); ok || err != nil {
+		t.Errorf("elevation without tile is %v (%v, %v), expected none", elevation, ok, err)
+	}
+}
+
+func TestFillElevations(t *testing.T) {
+	provider, err := FromDirectory(writeTestTile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first track has a gap, the elevation of 0 next to it is real. The second
+	// track only has elevations of 0, so all of them are replaced.
+	gpxFile, err := gpx.FromBytes([]byte(`<gpx>
+		<trk><trkseg>
+			<trkpt lat="48.5" lon="11"><ele>1000</ele></trkpt>
+			<trkpt lat="48.5" lon="11.5"></trkpt>
+			<trkpt lat="48.5" lon="11.5"><ele>0</ele></trkpt>
+		</trkseg></trk>
+		<trk><trkseg>
+			<trkpt lat="48.5" lon="11"><ele>0</ele></trkpt>
+			<trkpt lat="48.5" lon="11.5"><ele>0</ele></trkpt>
+		</trkseg></trk>
+	</gpx>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filled, _, err := provider.FillElevations(&gpxFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filled != 3 {
+		t.Errorf("%d elevations filled, expected 3", filled)
+	}
+	for i, expected := range [][]float64{{1000, 500, 0}, {400, 500}} {
+		for j, point := range gpxFile.Tracks[i].Segments[0].Points {
+			if point.Elevation != expected[j] || !point.HasElevation {
+				t.Errorf("elevation of point %d of track %d is %v (%v), expected %v", j+1, i+1, point.Elevation, point.HasElevation, expected[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package elevation
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Value of samples without elevation data
+const conVoid int16 = -32768
+
+// tile returns the tile containing the coordinate, or nil if there is no file for it
+// in the directory. Tiles are read only once.
+func (provider *Provider) tile(latitude float64, longitude float64) (*tile, error) {
+	var name = tileName(latitude, longitude)
+	if loaded, ok := provider.tiles[name]; ok {
+		return loaded, nil
+	}
+
+	data, err := readTileFile(provider.directory, name)
+	if err != nil || data == nil {
+		provider.tiles[name] = nil
+		return nil, err
+	}
+
+	// SRTM1 tiles have 3601 x 3601 samples, SRTM3 tiles 1201 x 1201, each a signed
+	// big-endian 16 bit integer
+	var size = int(math.Round(math.Sqrt(float64(len(data) / 2))))
+	if size < 2 || size*size*2 != len(data) {
+		return nil, errors.New(name + ".hgt has an invalid size of " + strconv.Itoa(len(data)) + " bytes")
+	}
+	var loaded = &tile{
+		latitude:  int(math.Floor(latitude)),
+		longitude: int(math.Floor(longitude)),
+		size:      size,
+		samples:   make([]int16, size*size),
+	}
+	for i := range loaded.samples {
+		loaded.samples[i] = int16(binary.BigEndian.Uint16(data[2*i:]))
+	}
+
+	provider.tiles[name] = loaded
+	return loaded, nil
+}
+
+// readTileFile returns the contents of the .hgt file of the tile, which may also be
+// packed into a .hgt.zip file. Returns nil if neither exists.
+func readTileFile(directory string, name string) ([]byte, error) {
+	// Plain file, the case of the name differs between sources
+	for _, fileName := range []string{name + ".hgt", strings.ToLower(name) + ".hgt"} {
+		data, err := ioutil.ReadFile(filepath.Join(directory, fileName))
+		if err == nil {
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	// Zip file containing the .hgt file
+	for _, fileName := range []string{name + ".hgt.zip", strings.ToLower(name) + ".hgt.zip", name + ".SRTMGL1.hgt.zip"} {
+		archive, err := zip.OpenReader(filepath.Join(directory, fileName))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer archive.Close()
+
+		for _, file := range archive.File {
+			if strings.EqualFold(filepath.Ext(file.Name), ".hgt") {
+				reader, err := file.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer reader.Close()
+				return ioutil.ReadAll(reader)
+			}
+		}
+		return nil, errors.New(fileName + " does not contain a .hgt file")
+	}
+
+	return nil, nil
+}
+
+// tileName returns the name of the tile containing the coordinate, which is named
+// after its south west corner, e.g. N48E011
+func tileName(latitude float64, longitude float64) string {
+	var tileLatitude = int(math.Floor(latitude))
+	var tileLongitude = int(math.Floor(longitude))
+
+	var name string
+	if tileLatitude < 0 {
+		name = "S" + padNumber(-tileLatitude, 2)
+	} else {
+		name = "N" + padNumber(tileLatitude, 2)
+	}
+	if tileLongitude < 0 {
+		name = name + "W" + padNumber(-tileLongitude, 3)
+	} else {
+		name = name + "E" + padNumber(tileLongitude, 3)
+	}
+	return name
+}
+
+// padNumber formats a number with leading zeros
+func padNumber(number int, digits int) string {
+	var text = strconv.Itoa(number)
+	for len(text) < digits {
+		text = "0" + text
+	}
+	return text
+}
@@ -0,0 +1,16 @@
+package elevation
+
+// Provider looks up elevations in the SRTM tiles of a local directory
+type Provider struct {
+	directory string
+	tiles     map[string]*tile
+}
+
+// tile is a SRTM tile covering one degree of latitude and longitude. The samples
+// are stored row by row from north to south, each row from west to east.
+type tile struct {
+	latitude  int
+	longitude int
+	size      int
+	samples   []int16
+}
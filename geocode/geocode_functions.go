@@ -0,0 +1,492 @@
+package geocode
+
+import (
+	"encoding/gob"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Organized92/route2bimmer/gpx"
+)
+
+// Version of the index file format, increase whenever the index structure changes
+const conIndexVersion int = 2
+
+// Size of a grid cell of the road index in degrees
+const conCellSize float64 = 0.005
+
+// Latitude up to which the grid cells around a coordinate are searched for roads. Closer
+// to the poles, the cells get so narrow that far too many would have to be searched.
+const conPolarLatitude float64 = 80
+
+// Default maximum distance between a waypoint and its street
+const conMaxStreetDistance float64 = 100
+
+// Admin levels of the boundaries we are interested in. Postal code boundaries are
+// stored with level conLevelPostalCode.
+const conLevelCountry int = 2
+const conLevelState int = 4
+const conLevelCounty int = 6
+const conLevelCity int = 8
+const conLevelPostalCode int = 100
+
+// FromFile returns a geocoder for the supplied OSM PBF extract. Building the index
+// takes a while, so it is cached in the user's cache directory and reused as long as
+// the extract does not change. If only the cache cannot be written, the geocoder is
+// returned together with a *CacheError and can be used nevertheless. See buildIndex
+// for the memory needed to build the index.
+func FromFile(pbfPath string) (Geocoder, error) {
+	var geocoder Geocoder
+	var err error
+
+	geocoder.MaxStreetDistance = conMaxStreetDistance
+
+	// Try to load the index from the cache
+	cachePath, err := indexCachePath(pbfPath)
+	if err != nil {
+		return geocoder, err
+	}
+	if cachePath != "" {
+		if geocoder.index, err = loadIndex(cachePath); err == nil {
+			return geocoder, nil
+		}
+	}
+
+	// Build the index and write it into the cache
+	geocoder.index, err = buildIndex(pbfPath)
+	if err != nil {
+		return geocoder, err
+	}
+	if cachePath != "" {
+		if err = saveIndex(cachePath, geocoder.index); err != nil {
+			return geocoder, &CacheError{Path: cachePath, Err: err}
+		}
+	}
+
+	return geocoder, nil
+}
+
+// Error returns the cache file and why it could not be written
+func (cacheError *CacheError) Error() string {
+	return "could not cache the index in " + cacheError.Path + ": " + cacheError.Err.Error()
+}
+
+// Unwrap returns the reason, so that errors.Is works
+func (cacheError *CacheError) Unwrap() error {
+	return cacheError.Err
+}
+
+// FillAddresses looks up the addresses of all route waypoints and fills in the
+// address fields which are still empty
+func (geocoder Geocoder) FillAddresses(gpxFile *gpx.GPX) {
+	for rteIndex := range gpxFile.Routes {
+		for rteWptIndex := range gpxFile.Routes[rteIndex].RouteWaypoints {
+			var waypoint = &gpxFile.Routes[rteIndex].RouteWaypoints[rteWptIndex]
+			var address = waypoint.GetAddress()
+			var found = geocoder.Lookup(waypoint.Latitude, waypoint.Longitude)
+
+			// Street and house number belong together
+			if address.Street == "" {
+				address.Street = found.Street
+				address.HouseNumber = ""
+			}
+			if address.City == "" {
+				address.City = found.City
+			}
+			if address.PostalCode == "" {
+				address.PostalCode = found.PostalCode
+			}
+			if address.State == "" {
+				address.State = found.State
+			}
+			if address.Country == "" {
+				address.Country = found.Country
+			}
+			waypoint.Address = address
+		}
+	}
+}
+
+// Lookup returns the address of a coordinate. The street is the name of the nearest
+// named road, the other fields are read from the surrounding boundaries.
+func (geocoder Geocoder) Lookup(latitude float64, longitude float64) gpx.Address {
+	var address gpx.Address
+	var position = point{latitude, longitude}
+
+	// Street: nearest road segment in the surrounding cells
+	var nearestDistance = geocoder.MaxStreetDistance
+	var cellLatitude = math.Min(math.Abs(latitude), conPolarLatitude)
+	var cellRadius = int(math.Ceil(geocoder.MaxStreetDistance / (conCellSize * gpx.MetersPerDegree() * math.Cos(cellLatitude*math.Pi/180))))
+	var cellLat, cellLon = cellOf(position)
+	for dLat := -cellRadius; dLat <= cellRadius; dLat++ {
+		for dLon := -cellRadius; dLon <= cellRadius; dLon++ {
+			for _, segmentIndex := range geocoder.index.Cells[cellKey(cellLat+dLat, cellLon+dLon)] {
+				var segment = geocoder.index.Segments[segmentIndex]
+				var distance = distanceToSegment(position, segment.From, segment.To)
+				if distance <= nearestDistance {
+					nearestDistance = distance
+					address.Street = geocoder.index.Names[segment.Name]
+				}
+			}
+		}
+	}
+
+	// Places: all boundaries containing the coordinate
+	var cityLevel int
+	for _, boundary := range geocoder.index.Boundaries {
+		if !boundary.contains(position) {
+			continue
+		}
+		var name = geocoder.index.Names[boundary.Name]
+		switch {
+		case boundary.Level == conLevelCountry:
+			address.Country = name
+		case boundary.Level == conLevelState:
+			address.State = name
+		case boundary.Level == conLevelPostalCode:
+			address.PostalCode = name
+		case boundary.Level >= conLevelCounty && boundary.Level <= conLevelCity && boundary.Level > cityLevel:
+			// The most detailed level is the city
+			address.City = name
+			cityLevel = boundary.Level
+		}
+	}
+
+	return address
+}
+
+// buildIndex reads the OSM extract and builds the spatial index. The file is read
+// three times: first the boundary relations, then the ways, and finally the
+// coordinates of the nodes we need. All of this is kept in memory: the nodes of
+// named roads and boundaries take about 100 bytes each, on top of the ways. This is
+// fine for regional extracts (e.g. a state or a small country), but country-size
+// extracts need several gigabytes; cut them down to the region of the route first.
+func buildIndex(pbfPath string) (index, error) {
+	var idx index
+	var boundaries []osmBoundary
+	var roadWays = make(map[int64][]int64)
+	var roadNames = make(map[int64]string)
+	var boundaryWays = make(map[int64][]int64)
+	var neededNodes = make(map[int64]bool)
+	var nodes = make(map[int64]point)
+	var err error
+
+	// Boundary relations
+	err = readPBF(pbfPath, pbfHandler{
+		relation: func(id int64, tags map[string]string, members []pbfMember) {
+			var boundary osmBoundary
+			switch {
+			case tags["boundary"] == "administrative" && tags["name"] != "":
+				boundary.level, _ = strconv.Atoi(tags["admin_level"])
+				boundary.name = tags["name"]
+				if boundary.level < conLevelCountry || boundary.level > conLevelCity {
+					return
+				}
+			case tags["boundary"] == "postal_code" && tags["postal_code"] != "":
+				boundary.level = conLevelPostalCode
+				boundary.name = tags["postal_code"]
+			default:
+				return
+			}
+
+			for _, member := range members {
+				if member.memberType == conMemberWay && (member.role == "outer" || member.role == "inner" || member.role == "") {
+					boundary.wayIDs = append(boundary.wayIDs, member.id)
+					boundaryWays[member.id] = nil
+				}
+			}
+			boundaries = append(boundaries, boundary)
+		},
+	})
+	if err != nil {
+		return idx, err
+	}
+
+	// Named roads and the ways of the boundaries
+	err = readPBF(pbfPath, pbfHandler{
+		way: func(id int64, tags map[string]string, refs []int64) {
+			var needed = false
+			if tags["highway"] != "" && tags["name"] != "" {
+				roadWays[id] = refs
+				roadNames[id] = tags["name"]
+				needed = true
+			}
+			if _, ok := boundaryWays[id]; ok {
+				boundaryWays[id] = refs
+				needed = true
+			}
+			if needed {
+				for _, ref := range refs {
+					neededNodes[ref] = true
+				}
+			}
+		},
+	})
+	if err != nil {
+		return idx, err
+	}
+
+	// Coordinates of the nodes. Nodes missing in the extract, e.g. because it was cut
+	// off in the middle of a way, are not put into the map.
+	err = readPBF(pbfPath, pbfHandler{
+		node: func(id int64, latitude float64, longitude float64) {
+			if neededNodes[id] {
+				nodes[id] = point{latitude, longitude}
+			}
+		},
+	})
+	if err != nil {
+		return idx, err
+	}
+
+	// Put everything into the index
+	idx.Version = conIndexVersion
+	idx.Cells = make(map[int64][]int32)
+	var nameIndices = make(map[string]int32)
+	var nameIndex = func(name string) int32 {
+		if existing, ok := nameIndices[name]; ok {
+			return existing
+		}
+		nameIndices[name] = int32(len(idx.Names))
+		idx.Names = append(idx.Names, name)
+		return nameIndices[name]
+	}
+
+	for id, refs := range roadWays {
+		var name = nameIndex(roadNames[id])
+		for i := 1; i < len(refs); i++ {
+			from, fromFound := nodes[refs[i-1]]
+			to, toFound := nodes[refs[i]]
+			if fromFound && toFound {
+				idx.addSegment(segment{from, to, name})
+			}
+		}
+	}
+
+	for _, osmBoundary := range boundaries {
+		var boundary boundary
+		boundary.Level = osmBoundary.level
+		boundary.Name = nameIndex(osmBoundary.name)
+		for _, ring := range assembleRings(osmBoundary.wayIDs, boundaryWays) {
+			// A ring with missing nodes would have the wrong shape, so it is dropped
+			var ringPoints []point
+			for _, ref := range ring {
+				node, found := nodes[ref]
+				if !found {
+					ringPoints = nil
+					break
+				}
+				ringPoints = append(ringPoints, node)
+			}
+			if ringPoints != nil {
+				boundary.Rings = append(boundary.Rings, ringPoints)
+			}
+		}
+		if len(boundary.Rings) > 0 {
+			boundary.calcBounds()
+			idx.Boundaries = append(idx.Boundaries, boundary)
+		}
+	}
+
+	return idx, err
+}
+
+// addSegment adds a road segment to the index and to all grid cells it touches
+func (idx *index) addSegment(seg segment) {
+	var segmentIndex = int32(len(idx.Segments))
+	idx.Segments = append(idx.Segments, seg)
+
+	fromLat, fromLon := cellOf(seg.From)
+	toLat, toLon := cellOf(seg.To)
+	for cellLat := minInt(fromLat, toLat); cellLat <= maxInt(fromLat, toLat); cellLat++ {
+		for cellLon := minInt(fromLon, toLon); cellLon <= maxInt(fromLon, toLon); cellLon++ {
+			var key = cellKey(cellLat, cellLon)
+			idx.Cells[key] = append(idx.Cells[key], segmentIndex)
+		}
+	}
+}
+
+// assembleRings joins the ways of a boundary into closed rings of node IDs. Rings
+// which cannot be closed, e.g. because the extract cuts off the boundary, are closed
+// with a straight line.
+func assembleRings(wayIDs []int64, ways map[int64][]int64) [][]int64 {
+	var rings [][]int64
+	var used = make([]bool, len(wayIDs))
+
+	for start := range wayIDs {
+		if used[start] || len(ways[wayIDs[start]]) < 2 {
+			continue
+		}
+		used[start] = true
+		var ring = append([]int64{}, ways[wayIDs[start]]...)
+
+		// Append matching ways until the ring is closed
+		for ring[0] != ring[len(ring)-1] {
+			var found = false
+			for i := range wayIDs {
+				var refs = ways[wayIDs[i]]
+				if used[i] || len(refs) < 2 {
+					continue
+				}
+				if refs[0] == ring[len(ring)-1] {
+					ring = append(ring, refs[1:]...)
+				} else if refs[len(refs)-1] == ring[len(ring)-1] {
+					for j := len(refs) - 2; j >= 0; j-- {
+						ring = append(ring, refs[j])
+					}
+				} else {
+					continue
+				}
+				used[i] = true
+				found = true
+				break
+			}
+			if !found {
+				ring = append(ring, ring[0])
+			}
+		}
+
+		if len(ring) >= 4 {
+			rings = append(rings, ring)
+		}
+	}
+
+	return rings
+}
+
+// calcBounds calculates the bounding box of a boundary
+func (b *boundary) calcBounds() {
+	b.Min = point{math.Inf(1), math.Inf(1)}
+	b.Max = point{math.Inf(-1), math.Inf(-1)}
+	for _, ring := range b.Rings {
+		for _, p := range ring {
+			b.Min.Latitude = math.Min(b.Min.Latitude, p.Latitude)
+			b.Min.Longitude = math.Min(b.Min.Longitude, p.Longitude)
+			b.Max.Latitude = math.Max(b.Max.Latitude, p.Latitude)
+			b.Max.Longitude = math.Max(b.Max.Longitude, p.Longitude)
+		}
+	}
+}
+
+// contains checks whether the coordinate lies inside the boundary, using the even-odd
+// rule over all rings so that inner rings are treated as holes
+func (b boundary) contains(p point) bool {
+	if p.Latitude < b.Min.Latitude || p.Latitude > b.Max.Latitude || p.Longitude < b.Min.Longitude || p.Longitude > b.Max.Longitude {
+		return false
+	}
+
+	var inside = false
+	for _, ring := range b.Rings {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			if (ring[i].Latitude > p.Latitude) != (ring[j].Latitude > p.Latitude) &&
+				p.Longitude < (ring[j].Longitude-ring[i].Longitude)*(p.Latitude-ring[i].Latitude)/(ring[j].Latitude-ring[i].Latitude)+ring[i].Longitude {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// distanceToSegment calculates the distance in meters between a coordinate and a
+// road segment, using a local flat projection around the coordinate
+func distanceToSegment(p point, from point, to point) float64 {
+	var scaleLat = gpx.MetersPerDegree()
+	var scaleLon = scaleLat * math.Cos(p.Latitude*math.Pi/180)
+
+	var ax = (from.Longitude - p.Longitude) * scaleLon
+	var ay = (from.Latitude - p.Latitude) * scaleLat
+	var bx = (to.Longitude - p.Longitude) * scaleLon
+	var by = (to.Latitude - p.Latitude) * scaleLat
+
+	// Project the coordinate (now the origin) onto the segment
+	var dx = bx - ax
+	var dy = by - ay
+	var t float64
+	if dx != 0 || dy != 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/(dx*dx+dy*dy)))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+// cellOf returns the grid cell a coordinate lies in
+func cellOf(p point) (int, int) {
+	return int(math.Floor(p.Latitude / conCellSize)), int(math.Floor(p.Longitude / conCellSize))
+}
+
+// cellKey combines the grid cell coordinates into a single map key
+func cellKey(cellLat int, cellLon int) int64 {
+	return int64(cellLat)<<32 | int64(uint32(cellLon))
+}
+
+// indexCachePath returns the path of the cached index for an OSM extract. The size
+// and the modification time of the extract are part of the file name, so a changed
+// extract gets a new index. An empty path means that there is no cache directory.
+func indexCachePath(pbfPath string) (string, error) {
+	info, err := os.Stat(pbfPath)
+	if err != nil {
+		return "", err
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", nil
+	}
+
+	var name = strings.TrimSuffix(filepath.Base(pbfPath), ".osm.pbf") + "-" +
+		strconv.FormatInt(info.Size(), 10) + "-" + strconv.FormatInt(info.ModTime().Unix(), 10) + ".idx"
+	return filepath.Join(cacheDir, "route2bimmer", name), nil
+}
+
+// loadIndex reads a cached index from disk
+func loadIndex(cachePath string) (index, error) {
+	var idx index
+
+	cacheFile, err := os.Open(cachePath)
+	if err != nil {
+		return idx, err
+	}
+	defer cacheFile.Close()
+
+	err = gob.NewDecoder(cacheFile).Decode(&idx)
+	if err == nil && idx.Version != conIndexVersion {
+		err = os.ErrNotExist
+	}
+	return idx, err
+}
+
+// saveIndex writes the index into the cache
+func saveIndex(cachePath string, idx index) error {
+	err := os.MkdirAll(filepath.Dir(cachePath), 0755)
+	if err != nil {
+		return err
+	}
+
+	cacheFile, err := os.Create(cachePath)
+	if err != nil {
+		return err
+	}
+
+	err = gob.NewEncoder(cacheFile).Encode(idx)
+	if err != nil {
+		cacheFile.Close()
+		os.Remove(cachePath)
+		return err
+	}
+	return cacheFile.Close()
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
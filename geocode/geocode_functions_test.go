@@ -0,0 +1,126 @@
+package geocode
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The fixture is built by testdata/make_test_pbf.py, see there
+const conTestFile string = "testdata/test.osm.pbf"
+
+func TestReadPBF(t *testing.T) {
+	var nodes = make(map[int64]point)
+	var ways = make(map[int64]map[string]string)
+	var members []pbfMember
+
+	err := readPBF(conTestFile, pbfHandler{
+		node: func(id int64, latitude float64, longitude float64) {
+			nodes[id] = point{latitude, longitude}
+		},
+		way: func(id int64, tags map[string]string, refs []int64) {
+			ways[id] = tags
+		},
+		relation: func(id int64, tags map[string]string, relationMembers []pbfMember) {
+			if id == 300 {
+				members = relationMembers
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 7 {
+		t.Errorf("%d nodes read, expected 7", len(nodes))
+	}
+	if p := nodes[12]; p.Latitude != 47.2 || p.Longitude != 11.3 {
+		t.Errorf("node 12 is at %v, expected 47.2, 11.3", p)
+	}
+	if ways[100]["name"] != "Brennerstraße" || ways[100]["highway"] != "primary" {
+		t.Errorf("tags of way 100 are %v", ways[100])
+	}
+	if len(members) != 2 || members[1].id != 201 || members[1].memberType != conMemberWay || members[1].role != "outer" {
+		t.Errorf("members of relation 300 are %v", members)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	idx, err := buildIndex(conTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var geocoder = Geocoder{MaxStreetDistance: conMaxStreetDistance, index: idx}
+
+	var address = geocoder.Lookup(47.0505, 11.05)
+	if address.Street != "Brennerstraße" || address.City != "Testdorf" {
+		t.Errorf("address is %+v, expected Brennerstraße in Testdorf", address)
+	}
+
+	// Outside of the boundary and far away from the road
+	address = geocoder.Lookup(47.5, 11.05)
+	if address.Street != "" || address.City != "" {
+		t.Errorf("address is %+v, expected none", address)
+	}
+}
+
+func TestMissingNodes(t *testing.T) {
+	idx, err := buildIndex(conTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Road and boundary using nodes which are not in the extract must not end at 0,0
+	for _, segment := range idx.Segments {
+		if idx.Names[segment.Name] == "Nullweg" {
+			t.Errorf("segment with missing node in the index: %v", segment)
+		}
+	}
+	for _, boundary := range idx.Boundaries {
+		if idx.Names[boundary.Name] == "Leerkreis" {
+			t.Errorf("boundary with missing node in the index: %v", boundary)
+		}
+	}
+
+	var geocoder = Geocoder{MaxStreetDistance: conMaxStreetDistance, index: idx}
+	if address := geocoder.Lookup(0, 0); address.Street != "" || address.City != "" {
+		t.Errorf("address at 0,0 is %+v, expected none", address)
+	}
+}
+
+func TestLookupPole(t *testing.T) {
+	idx, err := buildIndex(conTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var geocoder = Geocoder{MaxStreetDistance: conMaxStreetDistance, index: idx}
+
+	// Must return instead of searching an endless number of grid cells
+	if address := geocoder.Lookup(90, 0); address.Street != "" {
+		t.Errorf("address at the pole is %+v, expected none", address)
+	}
+}
+
+func TestFromFileUnwritableCache(t *testing.T) {
+	// A file where the cache directory should be, so that it cannot be created
+	var cacheHome = filepath.Join(t.TempDir(), "cache")
+	if err := ioutil.WriteFile(cacheHome, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	os.Setenv("XDG_CACHE_HOME", cacheHome)
+	if cacheDir, err := os.UserCacheDir(); err != nil || cacheDir != cacheHome {
+		t.Skip("cache directory is not taken from XDG_CACHE_HOME on this system")
+	}
+
+	geocoder, err := FromFile(conTestFile)
+	var cacheError *CacheError
+	if !errors.As(err, &cacheError) {
+		t.Fatalf("error %v, expected a CacheError", err)
+	}
+	if address := geocoder.Lookup(47.0505, 11.05); address.Street != "Brennerstraße" {
+		t.Errorf("address is %+v, expected Brennerstraße", address)
+	}
+}
@@ -0,0 +1,452 @@
+package geocode
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Protocol buffer wire types used in OSM PBF files
+const conWireVarint int = 0
+const conWireFixed64 int = 1
+const conWireBytes int = 2
+const conWireFixed32 int = 5
+
+// Maximum sizes of blob header and blob, as given by the OSM PBF specification
+const conMaxHeaderSize uint32 = 64 * 1024
+const conMaxBlobSize uint64 = 32 * 1024 * 1024
+
+// Member types of OSM relations
+const conMemberNode int = 0
+const conMemberWay int = 1
+const conMemberRelation int = 2
+
+// pbfHandler receives the elements read from an OSM PBF file. Elements without a
+// handler function are skipped.
+type pbfHandler struct {
+	node     func(id int64, latitude float64, longitude float64)
+	way      func(id int64, tags map[string]string, refs []int64)
+	relation func(id int64, tags map[string]string, members []pbfMember)
+}
+
+// pbfMember is a member of an OSM relation
+type pbfMember struct {
+	id         int64
+	memberType int
+	role       string
+}
+
+// primitiveBlock contains the data needed to decode the elements of a block
+type primitiveBlock struct {
+	stringTable []string
+	granularity int64
+	latOffset   int64
+	lonOffset   int64
+}
+
+// readPBF reads an OSM PBF file and passes all elements to the handler
+func readPBF(pbfPath string, handler pbfHandler) error {
+	// Open the PBF file
+	pbfFile, err := os.Open(pbfPath)
+	if err != nil {
+		return err
+	}
+	defer pbfFile.Close()
+
+	// The file is a sequence of blobs, each one preceded by its header
+	for {
+		var headerSize uint32
+		err = binary.Read(pbfFile, binary.BigEndian, &headerSize)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if headerSize > conMaxHeaderSize {
+			return errors.New("invalid blob header size in OSM PBF file")
+		}
+
+		// Blob header
+		var header = make([]byte, headerSize)
+		if _, err = io.ReadFull(pbfFile, header); err != nil {
+			return err
+		}
+		var blobType string
+		var blobSize uint64
+		err = readFields(header, func(field int, wireType int, value uint64, data []byte) error {
+			switch field {
+			case 1:
+				blobType = string(data)
+			case 3:
+				if value > conMaxBlobSize {
+					return errors.New("invalid blob size in OSM PBF file")
+				}
+				blobSize = value
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Blob
+		var blob = make([]byte, blobSize)
+		if _, err = io.ReadFull(pbfFile, blob); err != nil {
+			return err
+		}
+		data, err := decompressBlob(blob)
+		if err != nil {
+			return err
+		}
+
+		switch blobType {
+		case "OSMHeader":
+			err = checkHeaderBlock(data)
+		case "OSMData":
+			err = readPrimitiveBlock(data, handler)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// decompressBlob returns the uncompressed contents of a blob
+func decompressBlob(blob []byte) ([]byte, error) {
+	var raw []byte
+	var zlibData []byte
+
+	err := readFields(blob, func(field int, wireType int, value uint64, data []byte) error {
+		switch field {
+		case 1:
+			raw = data
+		case 3:
+			zlibData = data
+		case 4, 6, 7:
+			return errors.New("unsupported compression in OSM PBF file, only zlib is supported")
+		}
+		return nil
+	})
+	if err != nil || raw != nil {
+		return raw, err
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(zlibData))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// checkHeaderBlock makes sure that we are able to read the file
+func checkHeaderBlock(data []byte) error {
+	return readFields(data, func(field int, wireType int, value uint64, data []byte) error {
+		// Required features
+		if field == 4 {
+			var feature = string(data)
+			if feature != "OsmSchema-V0.6" && feature != "DenseNodes" {
+				return errors.New("unsupported feature \"" + feature + "\" in OSM PBF file")
+			}
+		}
+		return nil
+	})
+}
+
+// readPrimitiveBlock decodes the elements of a data block and passes them to the handler
+func readPrimitiveBlock(data []byte, handler pbfHandler) error {
+	var block primitiveBlock
+	var groups [][]byte
+
+	block.granularity = 100
+	err := readFields(data, func(field int, wireType int, value uint64, data []byte) error {
+		switch field {
+		case 1:
+			return readFields(data, func(field int, wireType int, value uint64, data []byte) error {
+				if field == 1 {
+					block.stringTable = append(block.stringTable, string(data))
+				}
+				return nil
+			})
+		case 2:
+			groups = append(groups, data)
+		case 17:
+			block.granularity = int64(value)
+		case 19:
+			block.latOffset = int64(value)
+		case 20:
+			block.lonOffset = int64(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The string table is needed for all groups, so they are decoded afterwards
+	for _, group := range groups {
+		err = readFields(group, func(field int, wireType int, value uint64, data []byte) error {
+			switch {
+			case field == 1 && handler.node != nil:
+				return block.readNode(data, handler)
+			case field == 2 && handler.node != nil:
+				return block.readDenseNodes(data, handler)
+			case field == 3 && handler.way != nil:
+				return block.readWay(data, handler)
+			case field == 4 && handler.relation != nil:
+				return block.readRelation(data, handler)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readNode decodes a single node
+func (block primitiveBlock) readNode(data []byte, handler pbfHandler) error {
+	var id, lat, lon int64
+
+	err := readFields(data, func(field int, wireType int, value uint64, data []byte) error {
+		switch field {
+		case 1:
+			id = zigzag(value)
+		case 8:
+			lat = zigzag(value)
+		case 9:
+			lon = zigzag(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	handler.node(id, block.coordinate(block.latOffset, lat), block.coordinate(block.lonOffset, lon))
+	return nil
+}
+
+// readDenseNodes decodes a group of delta encoded nodes
+func (block primitiveBlock) readDenseNodes(data []byte, handler pbfHandler) error {
+	var ids, lats, lons []uint64
+
+	err := readFields(data, func(field int, wireType int, value uint64, data []byte) error {
+		var err error
+		switch field {
+		case 1:
+			ids, err = readPacked(data)
+		case 8:
+			lats, err = readPacked(data)
+		case 9:
+			lons, err = readPacked(data)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return errors.New("invalid dense nodes in OSM PBF file")
+	}
+
+	var id, lat, lon int64
+	for i := range ids {
+		id = id + zigzag(ids[i])
+		lat = lat + zigzag(lats[i])
+		lon = lon + zigzag(lons[i])
+		handler.node(id, block.coordinate(block.latOffset, lat), block.coordinate(block.lonOffset, lon))
+	}
+	return nil
+}
+
+// readWay decodes a single way
+func (block primitiveBlock) readWay(data []byte, handler pbfHandler) error {
+	var id int64
+	var keys, vals, refs []uint64
+
+	err := readFields(data, func(field int, wireType int, value uint64, data []byte) error {
+		var err error
+		switch field {
+		case 1:
+			id = int64(value)
+		case 2:
+			keys, err = readPacked(data)
+		case 3:
+			vals, err = readPacked(data)
+		case 8:
+			refs, err = readPacked(data)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	tags, err := block.tags(keys, vals)
+	if err != nil {
+		return err
+	}
+
+	// The node references are delta encoded
+	var nodeIDs = make([]int64, len(refs))
+	var ref int64
+	for i := range refs {
+		ref = ref + zigzag(refs[i])
+		nodeIDs[i] = ref
+	}
+
+	handler.way(id, tags, nodeIDs)
+	return nil
+}
+
+// readRelation decodes a single relation
+func (block primitiveBlock) readRelation(data []byte, handler pbfHandler) error {
+	var id int64
+	var keys, vals, roles, memberIDs, types []uint64
+
+	err := readFields(data, func(field int, wireType int, value uint64, data []byte) error {
+		var err error
+		switch field {
+		case 1:
+			id = int64(value)
+		case 2:
+			keys, err = readPacked(data)
+		case 3:
+			vals, err = readPacked(data)
+		case 8:
+			roles, err = readPacked(data)
+		case 9:
+			memberIDs, err = readPacked(data)
+		case 10:
+			types, err = readPacked(data)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(roles) != len(memberIDs) || len(types) != len(memberIDs) {
+		return errors.New("invalid relation members in OSM PBF file")
+	}
+
+	tags, err := block.tags(keys, vals)
+	if err != nil {
+		return err
+	}
+
+	// The member IDs are delta encoded
+	var members = make([]pbfMember, len(memberIDs))
+	var memberID int64
+	for i := range memberIDs {
+		memberID = memberID + zigzag(memberIDs[i])
+		members[i].id = memberID
+		if types[i] > uint64(conMemberRelation) || roles[i] >= uint64(len(block.stringTable)) {
+			return errors.New("invalid relation members in OSM PBF file")
+		}
+		members[i].memberType = int(types[i])
+		members[i].role = block.stringTable[roles[i]]
+	}
+
+	handler.relation(id, tags, members)
+	return nil
+}
+
+// tags looks up the keys and values of an element in the string table
+func (block primitiveBlock) tags(keys []uint64, vals []uint64) (map[string]string, error) {
+	var tags = make(map[string]string, len(keys))
+
+	if len(keys) != len(vals) {
+		return tags, errors.New("invalid tags in OSM PBF file")
+	}
+	for i := range keys {
+		if keys[i] >= uint64(len(block.stringTable)) || vals[i] >= uint64(len(block.stringTable)) {
+			return tags, errors.New("invalid string reference in OSM PBF file")
+		}
+		tags[block.stringTable[keys[i]]] = block.stringTable[vals[i]]
+	}
+	return tags, nil
+}
+
+// coordinate converts an encoded latitude or longitude into degrees
+func (block primitiveBlock) coordinate(offset int64, value int64) float64 {
+	return float64(offset+block.granularity*value) / 1e9
+}
+
+// readFields walks through the fields of a protocol buffer message. Varints and fixed
+// size values are passed as value, length delimited fields as data.
+func readFields(message []byte, fn func(field int, wireType int, value uint64, data []byte) error) error {
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return errors.New("invalid protocol buffer message in OSM PBF file")
+		}
+		message = message[n:]
+
+		var field = int(key >> 3)
+		var wireType = int(key & 7)
+		var value uint64
+		var data []byte
+
+		switch wireType {
+		case conWireVarint:
+			value, n = binary.Uvarint(message)
+			if n <= 0 {
+				return errors.New("invalid varint in OSM PBF file")
+			}
+			message = message[n:]
+		case conWireFixed64:
+			if len(message) < 8 {
+				return errors.New("truncated protocol buffer message in OSM PBF file")
+			}
+			value = binary.LittleEndian.Uint64(message)
+			message = message[8:]
+		case conWireBytes:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return errors.New("truncated protocol buffer message in OSM PBF file")
+			}
+			data = message[n : n+int(length)]
+			message = message[n+int(length):]
+		case conWireFixed32:
+			if len(message) < 4 {
+				return errors.New("truncated protocol buffer message in OSM PBF file")
+			}
+			value = uint64(binary.LittleEndian.Uint32(message))
+			message = message[4:]
+		default:
+			return errors.New("unsupported wire type in OSM PBF file")
+		}
+
+		if err := fn(field, wireType, value, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPacked decodes a packed list of varints
+func readPacked(data []byte) ([]uint64, error) {
+	var values []uint64
+	for len(data) > 0 {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return values, errors.New("invalid packed field in OSM PBF file")
+		}
+		values = append(values, value)
+		data = data[n:]
+	}
+	return values, nil
+}
+
+// zigzag decodes a signed varint
+func zigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
@@ -0,0 +1,59 @@
+package geocode
+
+// Geocoder looks up addresses for coordinates using the data of an OSM extract
+type Geocoder struct {
+	// MaxStreetDistance is the maximum distance in meters between a coordinate and
+	// the road whose name is used as its street name
+	MaxStreetDistance float64
+
+	index index
+}
+
+// CacheError is returned by FromFile if the index has been built, but could not be
+// written into the cache. The geocoder can be used nevertheless.
+type CacheError struct {
+	// Path of the cache file
+	Path string
+
+	// Err is the reason
+	Err error
+}
+
+// index is the spatial index built from the OSM extract. It is cached on disk, so
+// its fields have to be exported for encoding/gob.
+type index struct {
+	Version    int
+	Names      []string
+	Segments   []segment
+	Cells      map[int64][]int32
+	Boundaries []boundary
+}
+
+// point is a coordinate in degrees
+type point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// segment is a piece of a named road between two nodes
+type segment struct {
+	From point
+	To   point
+	Name int32
+}
+
+// boundary is an administrative or postal code boundary
+type boundary struct {
+	Level int
+	Name  int32
+	Rings [][]point
+	Min   point
+	Max   point
+}
+
+// osmBoundary is a boundary relation as read from the OSM extract
+type osmBoundary struct {
+	level  int
+	name   string
+	wayIDs []int64
+}
@@ -0,0 +1,44 @@
+# Test fixture for the OSM PBF reader, build it with:
+#   python3 make_test_pbf.py
+# A named road and a village boundary, plus a road and a boundary which use nodes
+# missing in the extract.
+import struct, zlib
+def varint(v):
+    out=b''
+    while True:
+        b=v&0x7f; v>>=7
+        if v: out+=bytes([b|0x80])
+        else: return out+bytes([b])
+def zz(v): return (v<<1)^(v>>63) if v>=0 else ((-v)<<1)-1
+def key(f,w): return varint(f<<3|w)
+def fbytes(f,b): return key(f,2)+varint(len(b))+b
+def fvar(f,v): return key(f,0)+varint(v)
+def packed(vals): return b''.join(varint(v) for v in vals)
+strings=['']
+def s(x):
+    if x not in strings: strings.append(x)
+    return strings.index(x)
+# nodes: road along lat 47.05 from lon 11.0..11.2; boundary square 46.9..47.2 x 10.9..11.3
+nodes={1:(47.05,11.0),2:(47.05,11.1),3:(47.05,11.2),10:(46.9,10.9),11:(46.9,11.3),12:(47.2,11.3),13:(47.2,10.9)}
+ids=sorted(nodes)
+def delta(l):
+    out=[];p=0
+    for x in l: out.append(zz(x-p)); p=x
+    return out
+dense=fbytes(1,packed(delta(ids)))+fbytes(8,packed(delta([round(nodes[i][0]*1e7) for i in ids])))+fbytes(9,packed(delta([round(nodes[i][1]*1e7) for i in ids])))
+way1=fvar(1,100)+fbytes(2,packed([s('highway'),s('name')]))+fbytes(3,packed([s('primary'),s('Brennerstraße')]))+fbytes(8,packed(delta([1,2,3])))
+way2=fvar(1,200)+fbytes(8,packed(delta([10,11,12])))
+way3=fvar(1,201)+fbytes(8,packed(delta([10,13,12])))
+way4=fvar(1,101)+fbytes(2,packed([s('highway'),s('name')]))+fbytes(3,packed([s('residential'),s('Nullweg')]))+fbytes(8,packed(delta([3,99])))
+way5=fvar(1,202)+fbytes(8,packed(delta([10,98,12,10])))
+rel=fvar(1,300)+fbytes(2,packed([s('boundary'),s('admin_level'),s('name')]))+fbytes(3,packed([s('administrative'),s('8'),s('Testdorf')]))+fbytes(8,packed([s('outer'),s('outer')]))+fbytes(9,packed(delta([200,201])))+fbytes(10,packed([1,1]))
+rel2=fvar(1,301)+fbytes(2,packed([s('boundary'),s('admin_level'),s('name')]))+fbytes(3,packed([s('administrative'),s('6'),s('Leerkreis')]))+fbytes(8,packed([s('outer')]))+fbytes(9,packed(delta([202])))+fbytes(10,packed([1]))
+groups=fbytes(2,fbytes(2,dense))+fbytes(2,fbytes(3,way1)+fbytes(3,way2)+fbytes(3,way3)+fbytes(3,way4)+fbytes(3,way5))+fbytes(2,fbytes(4,rel)+fbytes(4,rel2))
+st=b''.join(fbytes(1,x.encode()) for x in strings)
+block=fbytes(1,st)+groups
+def blob(t,data):
+    b=fvar(2,len(data))+fbytes(3,zlib.compress(data))
+    h=fbytes(1,t.encode())+fvar(3,len(b))
+    return struct.pack('>I',len(h))+h+b
+hdr=fbytes(4,b'OsmSchema-V0.6')+fbytes(4,b'DenseNodes')
+open('test.osm.pbf','wb').write(blob('OSMHeader',hdr)+blob('OSMData',block))
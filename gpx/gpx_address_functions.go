@@ -0,0 +1,306 @@
+package gpx
+
+import (
+	"encoding/csv"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Maximum distance in meters between a route point and the waypoint its Garmin
+// address is taken from
+const conWaypointAddressDistance float64 = 1
+
+// addressKeys maps the keys allowed in structured descriptions and in the header of
+// address CSV files onto the fields of an address
+var addressKeys = map[string]string{
+	"country":      "country",
+	"state":        "state",
+	"region":       "state",
+	"city":         "city",
+	"place":        "city",
+	"postcode":     "postalcode",
+	"postalcode":   "postalcode",
+	"zip":          "postalcode",
+	"street":       "street",
+	"housenumber":  "housenumber",
+	"number":       "housenumber",
+	"streetnumber": "housenumber",
+}
+
+// GetAddress returns the postal address of the waypoint. An address set explicitly,
+// e.g. read from a CSV file, comes first. Otherwise the address is read from the
+// Garmin address extension of the route point or of the waypoint at its position
+// (see copyWaypointAddresses), and finally from a structured description like
+// "Street: Hauptstraße\nHouseNumber: 1\nCity: München". If the waypoint has no
+// address at all, an empty address will be returned.
+func (waypoint RouteWaypoint) GetAddress() Address {
+	if !waypoint.Address.IsEmpty() {
+		return waypoint.Address
+	}
+
+	// Garmin address extension
+	var garminAddress = waypoint.Extensions.GarminAddress
+	if !garminAddress.isEmpty() {
+		var address Address
+		address.Country = strings.TrimSpace(garminAddress.Country)
+		address.State = strings.TrimSpace(garminAddress.State)
+		address.City = strings.TrimSpace(garminAddress.City)
+		address.PostalCode = strings.TrimSpace(garminAddress.PostalCode)
+		if len(garminAddress.StreetAddress) > 0 {
+			address.Street, address.HouseNumber = splitHouseNumber(garminAddress.StreetAddress[0])
+		}
+		return address
+	}
+
+	// Structured description
+	if address, ok := parseAddressDescription(waypoint.Description); ok {
+		return address
+	}
+
+	return Address{}
+}
+
+// copyWaypointAddresses copies the Garmin address extension of the waypoints (<wpt>)
+// into the route points at the same position which have none. Garmin devices and
+// BaseCamp write the address only into the waypoint, not into the route point. If
+// several waypoints lie at the position, the one with the same name is used.
+func (gpx *GPX) copyWaypointAddresses() {
+	for rteIndex := range gpx.Routes {
+		for rteWptIndex := range gpx.Routes[rteIndex].RouteWaypoints {
+			var routeWaypoint = &gpx.Routes[rteIndex].RouteWaypoints[rteWptIndex]
+			if !routeWaypoint.Extensions.GarminAddress.isEmpty() {
+				continue
+			}
+
+			var found *Waypoint
+			for wptIndex := range gpx.Waypoints {
+				var waypoint = &gpx.Waypoints[wptIndex]
+				if waypoint.Extensions.GarminAddress.isEmpty() || GreatCircleDistance(routeWaypoint.Latitude, routeWaypoint.Longitude, waypoint.Latitude, waypoint.Longitude) > conWaypointAddressDistance {
+					continue
+				}
+				if found == nil || (waypoint.Name == routeWaypoint.Name && found.Name != routeWaypoint.Name) {
+					found = waypoint
+				}
+			}
+			if found != nil {
+				routeWaypoint.Extensions.GarminAddress = found.Extensions.GarminAddress
+			}
+		}
+	}
+}
+
+// isEmpty returns true if the Garmin address contains nothing we use
+func (garminAddress GarminAddress) isEmpty() bool {
+	return garminAddress.City == "" && garminAddress.PostalCode == "" && len(garminAddress.StreetAddress) == 0
+}
+
+// IsEmpty returns true if none of the address fields is set
+func (address Address) IsEmpty() bool {
+	return address == Address{}
+}
+
+// AddressesFromFile reads waypoint addresses from a CSV file and assigns them to the
+// route waypoints. The first line of the file has to contain the column names. The
+// waypoint is identified either by the columns "route" and "waypoint" (both counting
+// from 1, "route" defaults to 1) or by the column "name", which assigns the address
+// to all waypoints with this name. The address itself is read
+// from the columns "country", "state", "city", "postalcode", "street" and
+// "housenumber". Columns may be separated by commas or semicolons.
+func (gpx *GPX) AddressesFromFile(csvPath string) error {
+	// Open the CSV file
+	csvFile, err := os.Open(csvPath)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+
+	// Read all lines
+	byteValue, err := ioutil.ReadAll(csvFile)
+	if err != nil {
+		return err
+	}
+	var content = string(byteValue)
+
+	// Detect the separator using the header line
+	var reader = csv.NewReader(strings.NewReader(content))
+	var header = strings.SplitN(content, "\n", 2)[0]
+	if strings.Count(header, ";") > strings.Count(header, ",") {
+		reader.Comma = ';'
+	}
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return errors.New("address file " + csvPath + " is empty")
+	}
+
+	// Map the column names onto the column indices
+	var columns = make(map[string]int)
+	for index, column := range records[0] {
+		columns[normalizeAddressKey(column)] = index
+	}
+	_, hasWaypoint := columns["waypoint"]
+	_, hasName := columns["name"]
+	if !hasWaypoint && !hasName {
+		return errors.New("address file " + csvPath + " needs a column \"waypoint\" or \"name\"")
+	}
+
+	// Assign the addresses line by line
+	for line, record := range records[1:] {
+		var address Address
+		for key, index := range columns {
+			if index < len(record) {
+				setAddressField(&address, key, record[index])
+			}
+		}
+
+		waypoints, err := gpx.findWaypoints(columns, record)
+		if err != nil {
+			return errors.New("address file " + csvPath + ", line " + strconv.Itoa(line+2) + ": " + err.Error())
+		}
+		for _, waypoint := range waypoints {
+			waypoint.Address = address
+		}
+	}
+
+	return nil
+}
+
+// findWaypoints returns the route waypoints a line of an address CSV file refers to.
+// A name may refer to several waypoints, e.g. the same place visited twice.
+func (gpx *GPX) findWaypoints(columns map[string]int, record []string) ([]*RouteWaypoint, error) {
+	var column = func(key string) string {
+		if index, ok := columns[key]; ok && index < len(record) {
+			return strings.TrimSpace(record[index])
+		}
+		return ""
+	}
+
+	// By index
+	if column("waypoint") != "" {
+		var routeNumber = 1
+		var err error
+		if column("route") != "" {
+			routeNumber, err = strconv.Atoi(column("route"))
+			if err != nil {
+				return nil, errors.New("invalid route number \"" + column("route") + "\"")
+			}
+		}
+		waypointNumber, err := strconv.Atoi(column("waypoint"))
+		if err != nil {
+			return nil, errors.New("invalid waypoint number \"" + column("waypoint") + "\"")
+		}
+		if routeNumber < 1 || routeNumber > len(gpx.Routes) {
+			return nil, errors.New("there is no route " + strconv.Itoa(routeNumber))
+		}
+		var route = &gpx.Routes[routeNumber-1]
+		if waypointNumber < 1 || waypointNumber > len(route.RouteWaypoints) {
+			return nil, errors.New("there is no waypoint " + strconv.Itoa(waypointNumber) + " in route " + strconv.Itoa(routeNumber))
+		}
+		return []*RouteWaypoint{&route.RouteWaypoints[waypointNumber-1]}, nil
+	}
+
+	// By name
+	var waypoints []*RouteWaypoint
+	for rteIndex := range gpx.Routes {
+		for rteWptIndex := range gpx.Routes[rteIndex].RouteWaypoints {
+			if gpx.Routes[rteIndex].RouteWaypoints[rteWptIndex].Name == column("name") {
+				waypoints = append(waypoints, &gpx.Routes[rteIndex].RouteWaypoints[rteWptIndex])
+			}
+		}
+	}
+	if len(waypoints) == 0 {
+		return nil, errors.New("there is no waypoint named \"" + column("name") + "\"")
+	}
+	return waypoints, nil
+}
+
+// parseAddressDescription reads an address from a description consisting only of
+// lines like "Key: Value" or "addr:key=value". The second return value is false if
+// the description does not look like that.
+func parseAddressDescription(description string) (Address, bool) {
+	var address Address
+
+	if strings.TrimSpace(description) == "" {
+		return address, false
+	}
+
+	for _, line := range strings.Split(description, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Split into key and value
+		line = strings.TrimPrefix(strings.TrimSpace(line), "addr:")
+		var index = strings.IndexAny(line, ":=")
+		if index < 0 {
+			return Address{}, false
+		}
+		var key = normalizeAddressKey(line[:index])
+		if _, ok := addressKeys[key]; !ok {
+			return Address{}, false
+		}
+		setAddressField(&address, key, line[index+1:])
+	}
+
+	return address, !address.IsEmpty()
+}
+
+// setAddressField sets the address field identified by key, if it is known
+func setAddressField(address *Address, key string, value string) {
+	value = strings.TrimSpace(value)
+	switch addressKeys[key] {
+	case "country":
+		address.Country = value
+	case "state":
+		address.State = value
+	case "city":
+		address.City = value
+	case "postalcode":
+		address.PostalCode = value
+	case "street":
+		address.Street = value
+	case "housenumber":
+		address.HouseNumber = value
+	}
+}
+
+// normalizeAddressKey converts a key like "Postal Code" or "house_number" into the
+// form used in addressKeys
+func normalizeAddressKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, key)
+}
+
+// splitHouseNumber splits a street address like "Hauptstraße 5a" or "5a Main Street"
+// into the street name and the house number
+func splitHouseNumber(streetAddress string) (string, string) {
+	var fields = strings.Fields(streetAddress)
+	if len(fields) < 2 {
+		return strings.TrimSpace(streetAddress), ""
+	}
+
+	// House number at the end (most european countries)
+	if unicode.IsDigit([]rune(fields[len(fields)-1])[0]) {
+		return strings.Join(fields[:len(fields)-1], " "), fields[len(fields)-1]
+	}
+
+	// House number at the beginning (e.g. UK and US)
+	if unicode.IsDigit([]rune(fields[0])[0]) {
+		return strings.Join(fields[1:], " "), fields[0]
+	}
+
+	return strings.Join(fields, " "), ""
+}
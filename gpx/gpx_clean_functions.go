@@ -0,0 +1,205 @@
+package gpx
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Default limits for outliers
+const conDefaultCleanMaxSpeed float64 = 300
+const conDefaultCleanMaxJump float64 = 5000
+
+// CleanOptions controls how GPS errors are removed from the tracks
+type CleanOptions struct {
+	// MaxSpeed in km/h above which a point is an outlier, if it is reached on the
+	// way to the point and back. 0 means 300 km/h.
+	MaxSpeed float64
+
+	// MaxJump in meters above which a point without timestamps is an outlier, if
+	// the track jumps to the point and back. 0 means 5000 meters.
+	MaxJump float64
+
+	// ElevationSmoothing is the length in meters over which the elevations of the
+	// track points are averaged. 0 keeps the elevations.
+	ElevationSmoothing float64
+}
+
+// Clean removes errors of the GPS recording from the tracks, so that distance and
+// duration are not inflated: empty segments, consecutive duplicate points, invalid
+// and out-of-order timestamps and points far off the track. Optionally, the
+// elevations are smoothed. Returns a description of every change.
+func (gpx *GPX) Clean(options CleanOptions) []string {
+	var changes []string
+
+	if options.MaxSpeed <= 0 {
+		options.MaxSpeed = conDefaultCleanMaxSpeed
+	}
+	if options.MaxJump <= 0 {
+		options.MaxJump = conDefaultCleanMaxJump
+	}
+
+	// Loop over the tracks
+	for i := range gpx.Tracks {
+		var track = &gpx.Tracks[i]
+		var counts = make(map[string]int)
+		var segments []TrackSegment
+
+		for _, segment := range track.Segments {
+			if len(segment.Points) == 0 {
+				counts["empty segments removed"]++
+				continue
+			}
+
+			var removed int
+			segment.Points, removed = removeDuplicates(segment.Points)
+			counts["duplicate points removed"] += removed
+
+			var repaired, sorted int
+			segment.Points, removed, repaired, sorted = repairTimestamps(segment.Points)
+			counts["invalid timestamps removed"] += removed
+			counts["timestamps repaired"] += repaired
+			counts["points sorted by time"] += sorted
+
+			segment.Points, removed = removeOutliers(segment.Points, options)
+			counts["outliers removed"] += removed
+
+			if options.ElevationSmoothing > 0 && len(segment.Points) > 2 {
+				var elevations = segment.elevations(DistanceOptions{ElevationSmoothing: options.ElevationSmoothing})
+				for p := range segment.Points {
+					segment.Points[p].Elevation = elevations[p]
+				}
+				counts["points with smoothed elevation"] += len(segment.Points)
+			}
+
+			segments = append(segments, segment)
+		}
+		track.Segments = segments
+
+		// Describe the changes in a fixed order
+		for _, key := range []string{"empty segments removed", "duplicate points removed", "invalid timestamps removed", "timestamps repaired", "points sorted by time", "outliers removed", "points with smoothed elevation"} {
+			if counts[key] > 0 {
+				changes = append(changes, "Track "+strconv.Itoa(i+1)+" \""+track.Name+"\": "+key+": "+strconv.Itoa(counts[key]))
+			}
+		}
+	}
+
+	return changes
+}
+
+// removeDuplicates drops points which are identical to the point before. Points at
+// the same position with different timestamps are kept, they belong to a stop.
+func removeDuplicates(points []TrackPoint) ([]TrackPoint, int) {
+	var result []TrackPoint
+	for i, point := range points {
+		if i > 0 && point == points[i-1] {
+			continue
+		}
+		result = append(result, point)
+	}
+	return result, len(points) - len(result)
+}
+
+// repairTimestamps removes timestamps which cannot be parsed and brings the points
+// into chronological order. A single timestamp out of order is replaced by the one
+// in the middle of its neighbours, otherwise the points are sorted by time. Returns
+// the points and the number of removed, repaired and sorted timestamps.
+func repairTimestamps(points []TrackPoint) ([]TrackPoint, int, int, int) {
+	var removed, repaired, sorted int
+
+	// Parse the timestamps, points without timestamp cannot be ordered
+	var times = make([]time.Time, len(points))
+	var complete = true
+	for i := range points {
+		if points[i].Time == "" {
+			complete = false
+			continue
+		}
+		pointTime, err := time.Parse(time.RFC3339, points[i].Time)
+		if err != nil {
+			points[i].Time = ""
+			removed++
+			complete = false
+			continue
+		}
+		times[i] = pointTime
+	}
+	if !complete {
+		return points, removed, repaired, sorted
+	}
+
+	// Single timestamps out of order, i.e. the neighbours are in order
+	for i := 1; i < len(points)-1; i++ {
+		if times[i].Before(times[i-1]) || times[i].After(times[i+1]) {
+			if !times[i+1].Before(times[i-1]) && (i < 2 || !times[i-1].Before(times[i-2])) {
+				times[i] = times[i-1].Add(times[i+1].Sub(times[i-1]) / 2)
+				points[i].Time = times[i].Format(time.RFC3339)
+				repaired++
+			}
+		}
+	}
+
+	// Anything else has to be sorted
+	var order = make([]int, len(points))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a int, b int) bool {
+		return times[order[a]].Before(times[order[b]])
+	})
+	var result = make([]TrackPoint, len(points))
+	for i, index := range order {
+		result[i] = points[index]
+		if index != i {
+			sorted++
+		}
+	}
+
+	return result, removed, repaired, sorted
+}
+
+// removeOutliers drops points the track jumps to and back, too fast or too far to
+// be real. The first and the last point are outliers if the track jumps away from
+// them.
+func removeOutliers(points []TrackPoint, options CleanOptions) ([]TrackPoint, int) {
+	if len(points) < 3 {
+		return points, 0
+	}
+
+	// A jump between two points is too fast, or too far if there are no timestamps
+	var isJump = func(from TrackPoint, to TrackPoint) bool {
+		var distance = approximateDistance(from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+		fromTime, errFrom := time.Parse(time.RFC3339, from.Time)
+		toTime, errTo := time.Parse(time.RFC3339, to.Time)
+		if errFrom != nil || errTo != nil {
+			return distance > options.MaxJump
+		}
+		var seconds = toTime.Sub(fromTime).Seconds()
+		if seconds <= 0 {
+			return distance > options.MaxJump
+		}
+		return distance/seconds*3.6 > options.MaxSpeed
+	}
+
+	var result []TrackPoint
+	for i, point := range points {
+		var outlier bool
+		switch {
+		case i == 0:
+			outlier = isJump(point, points[1]) && !isJump(points[1], points[2])
+		case i == len(points)-1:
+			outlier = isJump(result[len(result)-1], point) && (len(result) < 2 || !isJump(result[len(result)-2], result[len(result)-1]))
+		case len(result) == 0:
+			// The first point was an outlier, its neighbour is kept
+			outlier = false
+		default:
+			var before = result[len(result)-1]
+			outlier = isJump(before, point) && isJump(point, points[i+1]) && !isJump(before, points[i+1])
+		}
+		if !outlier {
+			result = append(result, point)
+		}
+	}
+
+	return result, len(points) - len(result)
+}
@@ -0,0 +1,175 @@
+package gpx
+
+import "math"
+
+// Methods to calculate the distance between two track points
+const (
+	// DistanceSphere adds up straight lines between the points on a sphere
+	DistanceSphere string = "sphere"
+
+	// DistanceGeodesic adds up the shortest paths between the points on the WGS84
+	// ellipsoid
+	DistanceGeodesic string = "geodesic"
+)
+
+// Parameters of the WGS84 ellipsoid
+const conWGS84SemiMajorAxis float64 = 6378137
+const conWGS84Flattening float64 = 1 / 298.257223563
+
+// Iterations of Vincenty's formula until we give up and use the sphere instead,
+// which only happens for nearly antipodal points
+const conVincentyMaxIterations int = 200
+
+// DistanceOptions controls how the distance of a track is calculated. The zero
+// value calculates straight lines on a sphere, including the elevation.
+type DistanceOptions struct {
+	// Method is DistanceSphere or DistanceGeodesic, empty means DistanceSphere
+	Method string
+
+	// TwoDimensional ignores the elevation of the track points
+	TwoDimensional bool
+
+	// ElevationSmoothing is the length in meters over which the elevations are
+	// averaged, to reduce the noise of GPS altitudes. 0 disables smoothing.
+	ElevationSmoothing float64
+}
+
+// CalcDistance calculates the distance of a GPX track in meters
+func (track Track) CalcDistance(options DistanceOptions) float64 {
+	var totalDistance float64
+
+	// We have to loop over the track segments
+	for _, segment := range track.Segments {
+		var elevations = segment.elevations(options)
+
+		// We skip the first point so that we will not run out of bounds
+		for i := 1; i < len(segment.Points); i++ {
+			var from = segment.Points[i-1]
+			var to = segment.Points[i]
+			totalDistance = totalDistance + pointDistance(from.Latitude, from.Longitude, elevations[i-1], to.Latitude, to.Longitude, elevations[i], options)
+		}
+	}
+
+	return totalDistance
+}
+
+// elevations returns the elevations of the track points, smoothed as set in the
+// options. If the distance is two dimensional, all elevations are 0.
+func (segment TrackSegment) elevations(options DistanceOptions) []float64 {
+	var elevations = make([]float64, len(segment.Points))
+	if options.TwoDimensional {
+		return elevations
+	}
+	for i, point := range segment.Points {
+		elevations[i] = point.Elevation
+	}
+	if options.ElevationSmoothing <= 0 || len(elevations) < 3 {
+		return elevations
+	}
+
+	// Position of every point along the segment, without elevation
+	var flat = options
+	flat.TwoDimensional = true
+	var positions = make([]float64, len(segment.Points))
+	for i := 1; i < len(segment.Points); i++ {
+		var from = segment.Points[i-1]
+		var to = segment.Points[i]
+		positions[i] = positions[i-1] + pointDistance(from.Latitude, from.Longitude, 0, to.Latitude, to.Longitude, 0, flat)
+	}
+
+	// Moving average of all points within half the smoothing length in front of and
+	// behind the point
+	var smoothed = make([]float64, len(elevations))
+	var first = 0
+	var last = 0
+	var sum float64
+	for i := range elevations {
+		for last < len(elevations) && positions[last] <= positions[i]+options.ElevationSmoothing/2 {
+			sum = sum + elevations[last]
+			last++
+		}
+		for positions[first] < positions[i]-options.ElevationSmoothing/2 {
+			sum = sum - elevations[first]
+			first++
+		}
+		smoothed[i] = sum / float64(last-first)
+	}
+
+	return smoothed
+}
+
+// pointDistance calculates the distance between two points in meters
+func pointDistance(latitude1 float64, longitude1 float64, elevation1 float64, latitude2 float64, longitude2 float64, elevation2 float64, options DistanceOptions) float64 {
+	if options.Method != DistanceGeodesic {
+		var coord = coordinatesToMeters(elevation2, latitude2, longitude2)
+		var coordBefore = coordinatesToMeters(elevation1, latitude1, longitude1)
+		return math.Sqrt(math.Pow(coord.x-coordBefore.x, 2) + math.Pow(coord.y-coordBefore.y, 2) + math.Pow(coord.z-coordBefore.z, 2))
+	}
+
+	// The elevation difference is added as the other side of a right triangle
+	var distance = geodesicDistance(latitude1, longitude1, latitude2, longitude2)
+	return math.Hypot(distance, elevation2-elevation1)
+}
+
+// geodesicDistance calculates the length of the shortest path between two points on
+// the WGS84 ellipsoid in meters, using the inverse formula of Vincenty
+func geodesicDistance(latitude1 float64, longitude1 float64, latitude2 float64, longitude2 float64) float64 {
+	const a = conWGS84SemiMajorAxis
+	const f = conWGS84Flattening
+	const b = a * (1 - f)
+
+	if latitude1 == latitude2 && longitude1 == longitude2 {
+		return 0
+	}
+
+	// Reduced latitudes
+	var u1 = math.Atan((1 - f) * math.Tan(latitude1*math.Pi/180))
+	var u2 = math.Atan((1 - f) * math.Tan(latitude2*math.Pi/180))
+	var sinU1, cosU1 = math.Sincos(u1)
+	var sinU2, cosU2 = math.Sincos(u2)
+
+	var l = normalizeLongitude(longitude2-longitude1) * math.Pi / 180
+	var lambda = l
+	var sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+
+	// Iterate until the longitude on the auxiliary sphere does not change any more
+	var converged bool
+	for i := 0; i < conVincentyMaxIterations; i++ {
+		var sinLambda, cosLambda = math.Sincos(lambda)
+		sinSigma = math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			return 0
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+		var sinAlpha = cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		// cosSqAlpha is 0 if both points are on the equator
+		cos2SigmaM = 0
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+		var c = f / 16 * cosSqAlpha * (4 + f*(4-3*cosSqAlpha))
+		var lambdaBefore = lambda
+		lambda = l + (1-c)*f*sinAlpha*(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-lambdaBefore) < 1e-12 {
+			converged = true
+			break
+		}
+	}
+
+	// Nearly antipodal points, the sphere is good enough here
+	if !converged {
+		var coord = coordinatesToMeters(0, latitude2, longitude2)
+		var coordBefore = coordinatesToMeters(0, latitude1, longitude1)
+		var chord = math.Sqrt(math.Pow(coord.x-coordBefore.x, 2) + math.Pow(coord.y-coordBefore.y, 2) + math.Pow(coord.z-coordBefore.z, 2))
+		return 2 * conEarthRadiusInMeters * math.Asin(math.Min(1, chord/(2*conEarthRadiusInMeters)))
+	}
+
+	var uSq = cosSqAlpha * (a*a - b*b) / (b * b)
+	var bigA = 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	var bigB = uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	var deltaSigma = bigB * sinSigma * (cos2SigmaM + bigB/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-bigB/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+
+	return b * bigA * (sigma - deltaSigma)
+}
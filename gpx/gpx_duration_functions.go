@@ -0,0 +1,221 @@
+package gpx
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// Length in meters over which the curvature of a track is measured
+const conCurvatureWindow float64 = 200
+
+// SpeedProfile describes how fast a vehicle is driven, used to estimate the duration
+// of tracks without timestamps. The speed drops on curvy and on steep sections.
+type SpeedProfile struct {
+	Name string
+
+	// Speed in km/h on straight and flat roads
+	Speed float64
+
+	// MinSpeed in km/h, even in hairpins
+	MinSpeed float64
+
+	// Curvature in degrees per 100 meters at which the speed is halved
+	Curvature float64
+
+	// Gradient in percent at which the speed is halved
+	Gradient float64
+}
+
+// DurationOptions controls how the duration of a track is calculated
+type DurationOptions struct {
+	// Profile is used for tracks without timestamps
+	Profile SpeedProfile
+
+	// AverageSpeed in km/h overrides both the timestamps and the profile, if set
+	AverageSpeed float64
+
+	// Distance controls how the length of the track is calculated
+	Distance DistanceOptions
+
+	// MovingTime leaves out the stops of recorded tracks, instead of taking the
+	// time elapsed between the first and the last track point
+	MovingTime bool
+
+	// Stops controls how stops are detected for MovingTime
+	Stops StopOptions
+}
+
+// speedProfiles contains the built-in speed profiles
+var speedProfiles = []SpeedProfile{
+	{Name: "car", Speed: 80, MinSpeed: 25, Curvature: 60, Gradient: 15},
+	{Name: "motorcycle", Speed: 80, MinSpeed: 25, Curvature: 80, Gradient: 20},
+	{Name: "scenic", Speed: 55, MinSpeed: 20, Curvature: 60, Gradient: 15},
+}
+
+// SpeedProfileByName returns the built-in speed profile with the given name, e.g. "car"
+func SpeedProfileByName(name string) (SpeedProfile, error) {
+	for _, profile := range speedProfiles {
+		if strings.EqualFold(profile.Name, name) {
+			return profile, nil
+		}
+	}
+	return SpeedProfile{}, errors.New("unknown speed profile \"" + name + "\", known are: " + strings.Join(SpeedProfileNames(), ", "))
+}
+
+// SpeedProfileNames returns the names of all built-in speed profiles
+func SpeedProfileNames() []string {
+	var names []string
+	for _, profile := range speedProfiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// CalcDuration calculates the amount of time you will need for this track in seconds.
+// If an average speed is set, it is used together with the length of the track.
+// Otherwise the timestamps of the track are used, and if there are none, the
+// duration is estimated using the speed profile. Stops in recorded tracks are left
+// out if MovingTime is set.
+func (track Track) CalcDuration(options DurationOptions) (float64, error) {
+	var duration float64
+	var err error
+
+	// Average speed given by the user
+	if options.AverageSpeed > 0 {
+		duration = track.CalcDistance(options.Distance) / (options.AverageSpeed / 3.6)
+		return duration, err
+	}
+
+	// Timestamps
+	recorded, err := track.CalcTotalDuration()
+	if err != nil {
+		return duration, err
+	}
+	if recorded > 0 {
+		duration = float64(recorded)
+		if options.MovingTime {
+			movingTime, _, err := track.CalcMovingTime(options.Stops)
+			if err != nil {
+				return duration, err
+			}
+			duration = float64(movingTime)
+		}
+		return duration, err
+	}
+
+	duration = track.EstimateDuration(options.Profile, options.Distance)
+	return duration, err
+}
+
+// EstimateDuration estimates the amount of time needed to drive this track in
+// seconds, using the speed profile. The timestamps of the track are ignored.
+func (track Track) EstimateDuration(profile SpeedProfile, distanceOptions DistanceOptions) float64 {
+	var duration float64
+	if profile.Speed <= 0 {
+		return duration
+	}
+
+	// We have to loop over the track segments
+	for _, segment := range track.Segments {
+		var points = segment.Points
+		var elevations = segment.elevations(distanceOptions)
+
+		// Position of every point along the segment and the change of direction at
+		// every point in degrees
+		var flat = distanceOptions
+		flat.TwoDimensional = true
+		var positions = make([]float64, len(points))
+		var turns = make([]float64, len(points))
+		for i := 1; i < len(points); i++ {
+			positions[i] = positions[i-1] + pointDistance(points[i-1].Latitude, points[i-1].Longitude, 0, points[i].Latitude, points[i].Longitude, 0, flat)
+		}
+		for i := 1; i < len(points)-1; i++ {
+			// Duplicate points have no direction
+			if positions[i] == positions[i-1] || positions[i+1] == positions[i] {
+				continue
+			}
+			var bearingIn = bearing(points[i-1].Latitude, points[i-1].Longitude, points[i].Latitude, points[i].Longitude)
+			var bearingOut = bearing(points[i].Latitude, points[i].Longitude, points[i+1].Latitude, points[i+1].Longitude)
+			var turn = math.Abs(bearingOut - bearingIn)
+			if turn > 180 {
+				turn = 360 - turn
+			}
+			turns[i] = turn
+		}
+
+		// Loop over the legs between the points. The curvature is measured over the
+		// points around the middle of the leg.
+		var first = 0
+		var last = 0
+		var turnSum float64
+		for i := 1; i < len(points); i++ {
+			var length = pointDistance(points[i-1].Latitude, points[i-1].Longitude, elevations[i-1], points[i].Latitude, points[i].Longitude, elevations[i], distanceOptions)
+			var flatLength = positions[i] - positions[i-1]
+			if length <= 0 {
+				continue
+			}
+
+			var middle = (positions[i-1] + positions[i]) / 2
+			for last < len(points) && positions[last] <= middle+conCurvatureWindow/2 {
+				turnSum = turnSum + turns[last]
+				last++
+			}
+			for positions[first] < middle-conCurvatureWindow/2 {
+				turnSum = turnSum - turns[first]
+				first++
+			}
+			var curvature = turnSum / math.Max(conCurvatureWindow, flatLength) * 100
+
+			var gradient float64
+			if flatLength > 0 {
+				gradient = math.Abs(elevations[i]-elevations[i-1]) / flatLength * 100
+			}
+
+			duration = duration + length/(profile.speedAt(curvature, gradient)/3.6)
+		}
+	}
+
+	return duration
+}
+
+// speedAt returns the speed in km/h on a section with the given curvature in degrees
+// per 100 meters and the given gradient in percent
+func (profile SpeedProfile) speedAt(curvature float64, gradient float64) float64 {
+	var speed = profile.Speed
+	if profile.Curvature > 0 {
+		speed = speed / (1 + curvature/profile.Curvature)
+	}
+	if profile.Gradient > 0 {
+		speed = speed / (1 + gradient/profile.Gradient)
+	}
+	return math.Max(math.Min(speed, profile.Speed), math.Min(profile.MinSpeed, profile.Speed))
+}
+
+// bearing returns the direction from the first to the second point in degrees
+func bearing(latitude1 float64, longitude1 float64, latitude2 float64, longitude2 float64) float64 {
+	var phi1 = latitude1 * math.Pi / 180
+	var phi2 = latitude2 * math.Pi / 180
+	var deltaLambda = (longitude2 - longitude1) * math.Pi / 180
+
+	var y = math.Sin(deltaLambda) * math.Cos(phi2)
+	var x = math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(deltaLambda)
+	return math.Atan2(y, x) * 180 / math.Pi
+}
+
+// ToTrack returns a track connecting the waypoints of the route by straight lines,
+// which can be used if the GPX file does not contain a track for the route
+func (route Route) ToTrack() Track {
+	var track Track
+	var segment TrackSegment
+
+	track.Name = route.Name
+	for _, waypoint := range route.RouteWaypoints {
+		segment.Points = append(segment.Points, TrackPoint{Latitude: waypoint.Latitude, Longitude: waypoint.Longitude, Elevation: waypoint.Elevation})
+	}
+	if len(segment.Points) > 0 {
+		track.Segments = append(track.Segments, segment)
+	}
+
+	return track
+}
@@ -0,0 +1,330 @@
+package gpx
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Names of waypoints added when trimming a route by distance
+const conTrimStartName string = "Start"
+const conTrimEndName string = "Destination"
+
+// Distance in meters up to which an existing waypoint is used as new start or end
+// when trimming a route by distance
+const conTrimTolerance float64 = 100
+
+// Reverse reverses the direction of the track. Timestamps are mirrored, so that
+// duration and stops stay the same.
+func (track *Track) Reverse() {
+	var first, last = track.timeRange()
+
+	// Reverse the segments and their points
+	var segments = make([]TrackSegment, len(track.Segments))
+	for i, segment := range track.Segments {
+		var points = make([]TrackPoint, len(segment.Points))
+		for j, point := range segment.Points {
+			if pointTime, err := time.Parse(time.RFC3339, point.Time); err == nil {
+				point.Time = first.Add(last.Sub(pointTime)).Format(time.RFC3339Nano)
+			}
+			points[len(points)-1-j] = point
+		}
+		segment.Points = points
+		segments[len(segments)-1-i] = segment
+	}
+	track.Segments = segments
+}
+
+// Reverse reverses the order of the waypoints of the route
+func (route *Route) Reverse() {
+	var waypoints = make([]RouteWaypoint, len(route.RouteWaypoints))
+	for i, waypoint := range route.RouteWaypoints {
+		waypoints[len(waypoints)-1-i] = waypoint
+	}
+	route.RouteWaypoints = waypoints
+}
+
+// Reverse reverses the whole tour: the order of routes and tracks and each route
+// and track itself
+func (gpx *GPX) Reverse() {
+	var routes = make([]Route, len(gpx.Routes))
+	for i, route := range gpx.Routes {
+		route.Reverse()
+		routes[len(routes)-1-i] = route
+	}
+	gpx.Routes = routes
+
+	var tracks = make([]Track, len(gpx.Tracks))
+	for i, track := range gpx.Tracks {
+		track.Reverse()
+		tracks[len(tracks)-1-i] = track
+	}
+	gpx.Tracks = tracks
+}
+
+// ReverseRoute reverses a single route together with its track. This is not
+// possible if the track belongs to other routes as well, reverse the whole tour
+// then. The matches of all routes are passed, see updateMatch.
+func (gpx *GPX) ReverseRoute(index int, matches []TrackMatch) error {
+	if err := gpx.CheckRouteIndex(index); err != nil {
+		return err
+	}
+	var match = matches[index]
+	var trackIndex = exclusiveTrack(index, matches)
+	if match.Matched() && trackIndex < 0 {
+		return errors.New("track " + strconv.Itoa(match.TrackIndex+1) + " belongs to several routes, reverse the whole tour instead")
+	}
+
+	gpx.Routes[index].Reverse()
+	if trackIndex >= 0 {
+		gpx.Tracks[trackIndex].Reverse()
+	}
+	gpx.updateMatch(index, matches)
+	return nil
+}
+
+// SelectWaypoints replaces the waypoints of the route by the waypoints with the given
+// indexes, in the given order. This drops or reorders waypoints. The tracks are left
+// unchanged. The matches of all routes are passed, see updateMatch.
+func (gpx *GPX) SelectWaypoints(index int, waypoints []int, matches []TrackMatch) error {
+	if err := gpx.CheckRouteIndex(index); err != nil {
+		return err
+	}
+	var route = &gpx.Routes[index]
+	if len(waypoints) < 2 {
+		return errors.New("a route needs at least 2 waypoints")
+	}
+
+	var selected []RouteWaypoint
+	var used = make(map[int]bool)
+	for _, waypoint := range waypoints {
+		if waypoint < 0 || waypoint >= len(route.RouteWaypoints) {
+			return errors.New("route " + strconv.Itoa(index+1) + " has no waypoint " + strconv.Itoa(waypoint+1))
+		}
+		if used[waypoint] {
+			return errors.New("waypoint " + strconv.Itoa(waypoint+1) + " is selected twice")
+		}
+		used[waypoint] = true
+		selected = append(selected, route.RouteWaypoints[waypoint])
+	}
+	route.RouteWaypoints = selected
+	gpx.updateMatch(index, matches)
+
+	return nil
+}
+
+// TrimWaypoints keeps only the waypoints from and to of the route, including both.
+// The track of the route is cut accordingly, if it does not belong to other routes.
+// The matches of all routes are passed, see updateMatch.
+func (gpx *GPX) TrimWaypoints(index int, from int, to int, matches []TrackMatch) error {
+	if err := gpx.CheckRouteIndex(index); err != nil {
+		return err
+	}
+	var route = &gpx.Routes[index]
+	if from < 0 || to >= len(route.RouteWaypoints) || from >= to {
+		return errors.New("route " + strconv.Itoa(index+1) + " has no waypoints " + strconv.Itoa(from+1) + " to " + strconv.Itoa(to+1))
+	}
+
+	var match = matches[index]
+	if trackIndex := exclusiveTrack(index, matches); trackIndex >= 0 {
+		gpx.Tracks[trackIndex].Segments = match.Section.slice(match.Waypoints[from], match.Waypoints[to]).Segments
+	}
+	route.RouteWaypoints = append([]RouteWaypoint(nil), route.RouteWaypoints[from:to+1]...)
+	gpx.updateMatch(index, matches)
+
+	return nil
+}
+
+// TrimDistance keeps only the part of the route between two distances in meters from
+// its start. New waypoints are added at both ends, unless a waypoint is close by. A
+// distance to of 0 means up to the end. The track of the route is cut accordingly,
+// if it does not belong to other routes. The matches of all routes are passed, see
+// updateMatch.
+func (gpx *GPX) TrimDistance(index int, from float64, to float64, matches []TrackMatch) error {
+	if err := gpx.CheckRouteIndex(index); err != nil {
+		return err
+	}
+	var route = &gpx.Routes[index]
+	var track, positions = matches[index].Path(*route)
+
+	// Distance of every point along the route, without the gaps between segments
+	var points []TrackPoint
+	var distances []float64
+	var distance float64
+	for _, segment := range track.Segments {
+		for i, point := range segment.Points {
+			if i > 0 {
+				distance = distance + pointDistance(segment.Points[i-1].Latitude, segment.Points[i-1].Longitude, 0, point.Latitude, point.Longitude, 0, DistanceOptions{Method: DistanceGeodesic, TwoDimensional: true})
+			}
+			points = append(points, point)
+			distances = append(distances, distance)
+		}
+	}
+	if to <= 0 || to > distance {
+		to = distance
+	}
+	if from < 0 || from >= to {
+		return errors.New("route " + strconv.Itoa(index+1) + " is only " + strconv.FormatFloat(distance/1000, 'f', 1, 64) + " km long")
+	}
+
+	// pointAt returns the point at a distance and the index of the point before
+	var pointAt = func(target float64) (TrackPoint, int) {
+		var p = 0
+		for p < len(points)-2 && distances[p+1] <= target {
+			p++
+		}
+		var point = points[p]
+		if distances[p+1] > distances[p] && target > distances[p] {
+			var t = (target - distances[p]) / (distances[p+1] - distances[p])
+			point = interpolatePoint(points[p], points[p+1], t)
+			point.Latitude = roundCoordinate(point.Latitude)
+			point.Longitude = roundCoordinate(point.Longitude)
+			point.Elevation = points[p].Elevation + t*(points[p+1].Elevation-points[p].Elevation)
+			timeBefore, errBefore := time.Parse(time.RFC3339, points[p].Time)
+			timeAfter, errAfter := time.Parse(time.RFC3339, points[p+1].Time)
+			if errBefore == nil && errAfter == nil {
+				point.Time = timeBefore.Add(time.Duration(t * float64(timeAfter.Sub(timeBefore)))).Format(time.RFC3339Nano)
+			}
+		}
+		return point, p
+	}
+	var startPoint, startIndex = pointAt(from)
+	var endPoint, endIndex = pointAt(to)
+
+	// Waypoints within the distances, and new ones at the ends if needed
+	var waypoints []RouteWaypoint
+	var firstIndex, lastIndex = -1, -1
+	for i, waypoint := range route.RouteWaypoints {
+		if distances[positions[i]] >= from-conTrimTolerance && distances[positions[i]] <= to+conTrimTolerance {
+			waypoints = append(waypoints, waypoint)
+			if firstIndex < 0 {
+				firstIndex = i
+			}
+			lastIndex = i
+		}
+	}
+	if firstIndex < 0 || distances[positions[firstIndex]] > from+conTrimTolerance {
+		waypoints = append([]RouteWaypoint{{Name: conTrimStartName, Latitude: startPoint.Latitude, Longitude: startPoint.Longitude, Elevation: startPoint.Elevation}}, waypoints...)
+	}
+	if lastIndex < 0 || distances[positions[lastIndex]] < to-conTrimTolerance {
+		waypoints = append(waypoints, RouteWaypoint{Name: conTrimEndName, Latitude: endPoint.Latitude, Longitude: endPoint.Longitude, Elevation: endPoint.Elevation})
+	}
+	if len(waypoints) < 2 {
+		return errors.New("the trimmed route " + strconv.Itoa(index+1) + " has less than 2 waypoints")
+	}
+
+	// Cut the track between the new ends
+	if trackIndex := exclusiveTrack(index, matches); trackIndex >= 0 {
+		var segments = track.slice(startIndex+1, endIndex).Segments
+		if len(segments) == 0 {
+			segments = []TrackSegment{{}}
+		}
+		segments[0].Points = append([]TrackPoint{startPoint}, segments[0].Points...)
+		segments[len(segments)-1].Points = append(segments[len(segments)-1].Points, endPoint)
+		gpx.Tracks[trackIndex].Segments = segments
+	}
+	route.RouteWaypoints = waypoints
+	gpx.updateMatch(index, matches)
+
+	return nil
+}
+
+// RotateRoute lets a roundtrip start at another of its waypoints. The route has to
+// end where it starts, within the radius in meters. The track of the route is
+// rotated as well, if it does not belong to other routes, and its timestamps are
+// moved so that they keep increasing. The matches of all routes are passed, see
+// updateMatch.
+func (gpx *GPX) RotateRoute(index int, start int, radius float64, matches []TrackMatch) error {
+	if err := gpx.CheckRouteIndex(index); err != nil {
+		return err
+	}
+	var route = &gpx.Routes[index]
+	if !route.IsRoundtrip(radius) {
+		return errors.New("route " + strconv.Itoa(index+1) + " does not end where it starts")
+	}
+	var count = len(route.RouteWaypoints)
+	if start < 0 || start >= count-1 {
+		return errors.New("route " + strconv.Itoa(index+1) + " has no waypoint " + strconv.Itoa(start+1) + " to start at")
+	}
+	if start == 0 {
+		return nil
+	}
+
+	// Rotate the track: the part from the new start to the end comes first
+	var match = matches[index]
+	if trackIndex := exclusiveTrack(index, matches); trackIndex >= 0 {
+		var section = match.Section
+		var total = 0
+		for _, segment := range section.Segments {
+			total = total + len(segment.Points)
+		}
+		var first = section.slice(match.Waypoints[start], total-1)
+		var second = section.slice(0, match.Waypoints[start])
+		var sectionStart, sectionEnd = section.timeRange()
+		second.shiftTimes(sectionEnd.Sub(sectionStart))
+		gpx.Tracks[trackIndex].Segments = append(first.Segments, second.Segments...)
+	}
+
+	// The end of the roundtrip is the same as its start and is dropped, the new
+	// start is also the new end
+	var cycle = route.RouteWaypoints[:count-1]
+	var waypoints []RouteWaypoint
+	waypoints = append(waypoints, cycle[start:]...)
+	waypoints = append(waypoints, cycle[:start]...)
+	waypoints = append(waypoints, cycle[start])
+	route.RouteWaypoints = waypoints
+	gpx.updateMatch(index, matches)
+
+	return nil
+}
+
+// timeRange returns the first and the last timestamp of the track
+func (track Track) timeRange() (time.Time, time.Time) {
+	var first, last time.Time
+	for _, segment := range track.Segments {
+		for _, point := range segment.Points {
+			if pointTime, err := time.Parse(time.RFC3339, point.Time); err == nil {
+				if first.IsZero() {
+					first = pointTime
+				}
+				last = pointTime
+			}
+		}
+	}
+	return first, last
+}
+
+// shiftTimes moves all timestamps of the track by the duration
+func (track *Track) shiftTimes(duration time.Duration) {
+	for s := range track.Segments {
+		for p := range track.Segments[s].Points {
+			var point = &track.Segments[s].Points[p]
+			if pointTime, err := time.Parse(time.RFC3339, point.Time); err == nil {
+				point.Time = pointTime.Add(duration).Format(time.RFC3339Nano)
+			}
+		}
+	}
+}
+
+// exclusiveTrack returns the index of the track matching the route, if no other route
+// matches it as well. Otherwise -1 is returned. The matches of all routes are passed,
+// as returned by MatchTracks.
+func exclusiveTrack(index int, matches []TrackMatch) int {
+	if !matches[index].Matched() {
+		return -1
+	}
+	for i, match := range matches {
+		if i != index && match.TrackIndex == matches[index].TrackIndex {
+			return -1
+		}
+	}
+	return matches[index].TrackIndex
+}
+
+// CheckRouteIndex returns an error if there is no route with the index
+func (gpx GPX) CheckRouteIndex(index int) error {
+	if index < 0 || index >= len(gpx.Routes) {
+		return errors.New("there is no route " + strconv.Itoa(index+1))
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/xml"
 	"io/ioutil"
 	"os"
+	"strings"
 )
 
 // FromStdin reads all data from Stdin and converts it into a GPX file structure
@@ -17,11 +18,8 @@ func FromStdin() (GPX, error) {
 		return gpxContents, err
 	}
 
-	// Unmarshal the byteArray which contains the GPX file into the gpxContents
-	err = xml.Unmarshal(data, &gpxContents)
-
 	// Return the contents of the GPX file
-	return gpxContents, err
+	return FromBytes(data)
 }
 
 // FromFile reads the contents of the supplied filepath and returns a structure of type GPX in case of success
@@ -43,13 +41,63 @@ func FromFile(inputPath *string) (GPX, error) {
 		return gpxContents, err
 	}
 
+	// Return the contents of the GPX file
+	return FromBytes(byteValue)
+}
+
+// FromBytes converts the contents of a GPX file into a structure of type GPX
+func FromBytes(data []byte) (GPX, error) {
+	// Declare return value
+	var gpxContents GPX
+
 	// Unmarshal the byteArray which contains the GPX file into the gpxContents
-	err = xml.Unmarshal(byteValue, &gpxContents)
+	err := xml.Unmarshal(data, &gpxContents)
+	if err == nil {
+		gpxContents.copyWaypointAddresses()
+	}
 
 	// Return the contents of the GPX file
 	return gpxContents, err
 }
 
+// UnmarshalXML reads a track point and remembers if it has an elevation, because a
+// missing <ele> can not be told apart from an elevation of 0 otherwise
+func (point *TrackPoint) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	// Same fields, but without this method, so that decoding does not end up here again.
+	// The type is exported, because encoding/xml fails on unexported embedded structs.
+	type PlainTrackPoint TrackPoint
+	var element struct {
+		PlainTrackPoint
+		Elevation *float64 `xml:"ele"`
+	}
+
+	err := decoder.DecodeElement(&element, &start)
+	*point = TrackPoint(element.PlainTrackPoint)
+	if element.Elevation != nil {
+		point.Elevation = *element.Elevation
+		point.HasElevation = true
+	}
+	return err
+}
+
+// UnmarshalXML reads a route waypoint and remembers if it has an elevation, same as
+// for track points
+func (waypoint *RouteWaypoint) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	type PlainRouteWaypoint RouteWaypoint
+	var element struct {
+		PlainRouteWaypoint
+		Elevation *float64 `xml:"ele"`
+	}
+
+	err := decoder.DecodeElement(&element, &start)
+	*waypoint = RouteWaypoint(element.PlainRouteWaypoint)
+	if element.Elevation != nil {
+		waypoint.Elevation = *element.Elevation
+		waypoint.HasElevation = true
+	}
+	return err
+}
+
 // GetName returns the name of the route, first trying to read it from the GPX metadata,
 // and if not present here, from the first route. If both are empty, it will return
 // "Unnamed Route"
@@ -69,3 +117,119 @@ func (gpx GPX) GetName() string {
 	// Fallback
 	return "Unnamed Route"
 }
+
+// GetNames returns the name of the route in every language available in the GPX file.
+// The first entry is always the name returned by GetName. Its language is read from
+// the xml:lang attribute of the surrounding elements, or defaultLanguage if not present.
+// Further entries are the translations found in the extensions of the metadata and the
+// first route.
+func (gpx GPX) GetNames(defaultLanguage string) []LocalizedText {
+	var names []LocalizedText
+	var name LocalizedText
+
+	// The name itself, labeled with the language of the element it was read from
+	name.Value = gpx.GetName()
+	if gpx.Metadata.Name != "" || len(gpx.Routes) == 0 {
+		name.Language = firstLanguage(gpx.Metadata.Language, gpx.Language, defaultLanguage)
+	} else {
+		name.Language = firstLanguage(gpx.Routes[0].Language, gpx.Language, defaultLanguage)
+	}
+	names = append(names, name)
+
+	// Translations
+	names = appendTranslations(names, gpx.Metadata.Extensions.Names, defaultLanguage)
+	if len(gpx.Routes) >= 1 {
+		names = appendTranslations(names, gpx.Routes[0].Extensions.Names, defaultLanguage)
+	}
+
+	return names
+}
+
+// GetIntroductions returns the description found in the metadata of the GPX file
+// together with its translations. If there is no description, an empty list will
+// be returned.
+func (gpx GPX) GetIntroductions(defaultLanguage string) []LocalizedText {
+	var introductions []LocalizedText
+
+	if gpx.Metadata.Description != "" {
+		var introduction LocalizedText
+		introduction.Language = firstLanguage(gpx.Metadata.Language, gpx.Language, defaultLanguage)
+		introduction.Value = gpx.Metadata.Description
+		introductions = append(introductions, introduction)
+	}
+	introductions = appendTranslations(introductions, gpx.Metadata.Extensions.Descriptions, defaultLanguage)
+
+	return introductions
+}
+
+// GetDescriptions returns the descriptions of all routes in the GPX file, one entry
+// per language. If the file contains more than one route, the descriptions of the
+// routes will be joined line by line. If there is no description at all, an empty
+// list will be returned.
+func (gpx GPX) GetDescriptions(defaultLanguage string) []LocalizedText {
+	var descriptions []LocalizedText
+
+	for _, route := range gpx.Routes {
+		var routeDescriptions []LocalizedText
+
+		if route.Description != "" {
+			var description LocalizedText
+			description.Language = firstLanguage(route.Language, gpx.Language, defaultLanguage)
+			description.Value = route.Description
+			routeDescriptions = append(routeDescriptions, description)
+		}
+		routeDescriptions = appendTranslations(routeDescriptions, route.Extensions.Descriptions, defaultLanguage)
+
+		// Join them with the descriptions of the routes before
+		for _, routeDescription := range routeDescriptions {
+			var found = false
+			for i := range descriptions {
+				if strings.EqualFold(descriptions[i].Language, routeDescription.Language) {
+					descriptions[i].Value = descriptions[i].Value + "\n" + routeDescription.Value
+					found = true
+					break
+				}
+			}
+			if !found {
+				descriptions = append(descriptions, routeDescription)
+			}
+		}
+	}
+
+	return descriptions
+}
+
+// appendTranslations appends all non-empty translations to texts, skipping those
+// in a language which is already present
+func appendTranslations(texts []LocalizedText, translations []LocalizedText, defaultLanguage string) []LocalizedText {
+	for _, translation := range translations {
+		translation.Value = strings.TrimSpace(translation.Value)
+		translation.Language = firstLanguage(translation.Language, defaultLanguage)
+		if translation.Value == "" {
+			continue
+		}
+
+		var found = false
+		for _, text := range texts {
+			if strings.EqualFold(text.Language, translation.Language) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			texts = append(texts, translation)
+		}
+	}
+	return texts
+}
+
+// firstLanguage returns the first language code that is not empty, normalized with
+// NormalizeLanguage so that texts in the same language are recognized as such
+func firstLanguage(languages ...string) string {
+	for _, language := range languages {
+		if language != "" {
+			return NormalizeLanguage(language)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package gpx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeLanguage(t *testing.T) {
+	for code, expected := range map[string]string{
+		"de":    "de",
+		"ger":   "de",
+		"DEU":   "de",
+		"de-AT": "de",
+		"de_at": "de",
+		"fre":   "fr",
+		"fra":   "fr",
+		"xx-YY": "xx",
+		"":      "",
+	} {
+		if language := NormalizeLanguage(code); language != expected {
+			t.Errorf("language %q normalized to %q, expected %q", code, language, expected)
+		}
+	}
+}
+
+func TestTranslationsMixedCodes(t *testing.T) {
+	// ISO 639-1 and ISO 639-2 codes for the same language in one file
+	gpxFile, err := FromBytes([]byte(`<gpx xml:lang="ger">
+		<metadata>
+			<name>Alpenrunde</name>
+			<extensions>
+				<name xml:lang="de">Doppelt</name>
+				<name xml:lang="eng">Alpine tour</name>
+				<name xml:lang="en-GB">Twice</name>
+			</extensions>
+		</metadata>
+		<rte xml:lang="deu">
+			<desc>Erster Tag</desc>
+			<extensions><desc xml:lang="en">First day</desc></extensions>
+		</rte>
+		<rte>
+			<desc xml:lang="de">Zweiter Tag</desc>
+			<extensions><desc xml:lang="eng">Second day</desc></extensions>
+		</rte>
+	</gpx>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names = gpxFile.GetNames("en")
+	var expectedNames = []LocalizedText{{Language: "de", Value: "Alpenrunde"}, {Language: "en", Value: "Alpine tour"}}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("names are %v, expected %v", names, expectedNames)
+	}
+
+	var descriptions = gpxFile.GetDescriptions("en")
+	var expectedDescriptions = []LocalizedText{{Language: "de", Value: "Erster Tag\nZweiter Tag"}, {Language: "en", Value: "First day\nSecond day"}}
+	if !reflect.DeepEqual(descriptions, expectedDescriptions) {
+		t.Errorf("descriptions are %v, expected %v", descriptions, expectedDescriptions)
+	}
+}
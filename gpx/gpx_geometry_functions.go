@@ -0,0 +1,205 @@
+package gpx
+
+import (
+	"math"
+	"sort"
+)
+
+// Latitude in degrees from which on flat approximations are too inaccurate
+const conPolarLatitude float64 = 80
+
+// normalizeLongitude returns the longitude in the range from -180 to 180 degrees,
+// so that differences of longitudes take the short way across the antimeridian
+func normalizeLongitude(longitude float64) float64 {
+	var normalized = math.Mod(longitude+180, 360)
+	if normalized < 0 {
+		normalized = normalized + 360
+	}
+	return normalized - 180
+}
+
+// GreatCircleDistance returns the distance between two points on the earth in
+// meters, assuming it is a sphere
+func GreatCircleDistance(latitude1 float64, longitude1 float64, latitude2 float64, longitude2 float64) float64 {
+	var phi1 = latitude1 * math.Pi / 180
+	var phi2 = latitude2 * math.Pi / 180
+	var deltaPhi = phi2 - phi1
+	var deltaLambda = normalizeLongitude(longitude2-longitude1) * math.Pi / 180
+
+	var a = math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+	return 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a)) * conEarthRadiusInMeters
+}
+
+// MetersPerDegree returns the length of a degree of latitude in meters, which is also
+// the length of a degree of longitude at the equator
+func MetersPerDegree() float64 {
+	return math.Pi / 180 * conEarthRadiusInMeters
+}
+
+// vector is a point on the unit sphere
+type vector struct {
+	x float64
+	y float64
+	z float64
+}
+
+// toVector converts a coordinate into a point on the unit sphere
+func toVector(latitude float64, longitude float64) vector {
+	var phi = latitude * math.Pi / 180
+	var lambda = longitude * math.Pi / 180
+	return vector{math.Cos(phi) * math.Cos(lambda), math.Cos(phi) * math.Sin(lambda), math.Sin(phi)}
+}
+
+func (a vector) dot(b vector) float64 {
+	return a.x*b.x + a.y*b.y + a.z*b.z
+}
+
+func (a vector) cross(b vector) vector {
+	return vector{a.y*b.z - a.z*b.y, a.z*b.x - a.x*b.z, a.x*b.y - a.y*b.x}
+}
+
+func (a vector) length() float64 {
+	return math.Sqrt(a.dot(a))
+}
+
+// angle returns the angle between two points on the unit sphere in radians
+func (a vector) angle(b vector) float64 {
+	return math.Atan2(a.cross(b).length(), a.dot(b))
+}
+
+// projectOnLine returns where the point lies on the great circle between two other
+// points, from 0 (at the start) to 1 (at the end), and its distance in meters from
+// the line. This works across the antimeridian and at the poles.
+func projectOnLine(point TrackPoint, from TrackPoint, to TrackPoint) (float64, float64) {
+	var p = toVector(point.Latitude, point.Longitude)
+	var a = toVector(from.Latitude, from.Longitude)
+	var b = toVector(to.Latitude, to.Longitude)
+
+	// Start and end coincide
+	var lineAngle = a.angle(b)
+	var normal = a.cross(b)
+	if lineAngle < 1e-12 || normal.length() < 1e-12 {
+		return 0, a.angle(p) * conEarthRadiusInMeters
+	}
+
+	// Angle of the point along the line, measured from the start. Points beside
+	// the line are closest to one of its ends.
+	var scale = 1 / normal.length()
+	normal = vector{normal.x * scale, normal.y * scale, normal.z * scale}
+	var along = math.Atan2(a.cross(p).dot(normal), a.dot(p))
+	switch {
+	case along >= 0 && along <= lineAngle:
+		return along / lineAngle, math.Asin(math.Min(1, math.Abs(p.dot(normal)))) * conEarthRadiusInMeters
+	case a.angle(p) <= b.angle(p):
+		return 0, a.angle(p) * conEarthRadiusInMeters
+	default:
+		return 1, b.angle(p) * conEarthRadiusInMeters
+	}
+}
+
+// interpolatePoint returns the point at the fraction t of the great circle between
+// two points. Elevation and timestamp are not set.
+func interpolatePoint(from TrackPoint, to TrackPoint, t float64) TrackPoint {
+	var a = toVector(from.Latitude, from.Longitude)
+	var b = toVector(to.Latitude, to.Longitude)
+	var angle = a.angle(b)
+	if angle < 1e-12 {
+		return TrackPoint{Latitude: from.Latitude, Longitude: from.Longitude}
+	}
+
+	// Spherical linear interpolation
+	var weightA = math.Sin((1-t)*angle) / math.Sin(angle)
+	var weightB = math.Sin(t*angle) / math.Sin(angle)
+	var v = vector{weightA*a.x + weightB*b.x, weightA*a.y + weightB*b.y, weightA*a.z + weightB*b.z}
+	return TrackPoint{
+		Latitude:  math.Atan2(v.z, math.Hypot(v.x, v.y)) * 180 / math.Pi,
+		Longitude: math.Atan2(v.y, v.x) * 180 / math.Pi,
+	}
+}
+
+// LongitudeRange returns the western and the eastern edge of the smallest range
+// containing all longitudes. If the range crosses the antimeridian, west is greater
+// than east, e.g. 170 and -170 for a range of 20 degrees.
+func LongitudeRange(longitudes []float64) (float64, float64) {
+	if len(longitudes) == 0 {
+		return 0, 0
+	}
+
+	var sorted = make([]float64, len(longitudes))
+	for i, longitude := range longitudes {
+		sorted[i] = normalizeLongitude(longitude)
+	}
+	sort.Float64s(sorted)
+
+	// The range is everything except the largest gap between two longitudes,
+	// including the gap across the antimeridian
+	var west = sorted[0]
+	var east = sorted[len(sorted)-1]
+	var largestGap = sorted[0] + 360 - sorted[len(sorted)-1]
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i]-sorted[i-1] > largestGap {
+			largestGap = sorted[i] - sorted[i-1]
+			west = sorted[i]
+			east = sorted[i-1]
+		}
+	}
+
+	return west, east
+}
+
+// Simplify returns the track with as few points as possible, so that no point left
+// out is farther than tolerance meters away from the simplified track (Douglas-Peucker
+// algorithm). The distances are measured on great circles, so this works across the
+// antimeridian and near the poles. Every segment keeps its first and its last point.
+func (track Track) Simplify(tolerance float64) Track {
+	var simplified = track
+	simplified.Segments = nil
+	for _, segment := range track.Segments {
+		var keep = simplifyPoints(segment.Points, tolerance)
+		var points []TrackPoint
+		for i, point := range segment.Points {
+			if keep[i] {
+				points = append(points, point)
+			}
+		}
+		segment.Points = points
+		simplified.Segments = append(simplified.Segments, segment)
+	}
+	return simplified
+}
+
+// simplifyPoints tells for every point if it is kept by the Douglas-Peucker algorithm.
+// The sections still to be checked are kept on a stack instead of recursing, as
+// recorded tracks may have hundreds of thousands of points.
+func simplifyPoints(points []TrackPoint, tolerance float64) []bool {
+	var keep = make([]bool, len(points))
+	if len(points) == 0 {
+		return keep
+	}
+	keep[0] = true
+	keep[len(points)-1] = true
+
+	var sections = [][2]int{{0, len(points) - 1}}
+	for len(sections) > 0 {
+		var first, last = sections[len(sections)-1][0], sections[len(sections)-1][1]
+		sections = sections[:len(sections)-1]
+
+		// The point farthest away from the line between first and last point is kept,
+		// if it is beyond the tolerance. Then both halves are checked the same way.
+		var farthest = -1
+		var maxDistance = tolerance
+		for i := first + 1; i < last; i++ {
+			var _, distance = projectOnLine(points[i], points[first], points[last])
+			if distance > maxDistance {
+				farthest = i
+				maxDistance = distance
+			}
+		}
+		if farthest >= 0 {
+			keep[farthest] = true
+			sections = append(sections, [2]int{first, farthest}, [2]int{farthest, last})
+		}
+	}
+
+	return keep
+}
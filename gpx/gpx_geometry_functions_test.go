@@ -0,0 +1,131 @@
+package gpx
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeLongitude(t *testing.T) {
+	for _, test := range [][2]float64{
+		{0, 0},
+		{179.5, 179.5},
+		{180, -180},
+		{-180, -180},
+		{190, -170},
+		{-190, 170},
+		{360, 0},
+		{540, -180},
+		{-539, -179},
+	} {
+		if longitude := normalizeLongitude(test[0]); math.Abs(longitude-test[1]) > 1e-9 {
+			t.Errorf("longitude %v normalized to %v, expected %v", test[0], longitude, test[1])
+		}
+	}
+}
+
+func TestGreatCircleDistance(t *testing.T) {
+	for _, test := range []struct {
+		latitude1, longitude1, latitude2, longitude2 float64
+		distance                                     float64
+	}{
+		// One degree at the equator, also across the antimeridian
+		{0, 10, 0, 11, MetersPerDegree()},
+		{0, 179.5, 0, -179.5, MetersPerDegree()},
+		{0, -179.5, 0, 539.5, MetersPerDegree()},
+		// Over the pole
+		{89.5, 0, 89.5, 180, MetersPerDegree()},
+		{90, 0, 90, 123, 0},
+	} {
+		if distance := GreatCircleDistance(test.latitude1, test.longitude1, test.latitude2, test.longitude2); math.Abs(distance-test.distance) > 1e-3 {
+			t.Errorf("distance between %v, %v and %v, %v is %v, expected %v", test.latitude1, test.longitude1, test.latitude2, test.longitude2, distance, test.distance)
+		}
+	}
+}
+
+func TestLongitudeRange(t *testing.T) {
+	for _, test := range []struct {
+		longitudes []float64
+		west       float64
+		east       float64
+	}{
+		{nil, 0, 0},
+		{[]float64{11}, 11, 11},
+		{[]float64{30, 10, 20}, 10, 30},
+		// Across the antimeridian, west is greater than east
+		{[]float64{170, -170, 179}, 170, -170},
+		{[]float64{-179.5, 179.5}, 179.5, -179.5},
+		// Longitudes beyond 180 degrees
+		{[]float64{190, 175}, 175, -170},
+		// Around the whole world, the largest gap is left out
+		{[]float64{-100, 0, 100}, -100, 100},
+		{[]float64{-120, 0, 100, 130}, 0, -120},
+	} {
+		if west, east := LongitudeRange(test.longitudes); west != test.west || east != test.east {
+			t.Errorf("range of %v is %v to %v, expected %v to %v", test.longitudes, west, east, test.west, test.east)
+		}
+	}
+}
+
+func TestProjectOnLine(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		point    TrackPoint
+		from     TrackPoint
+		to       TrackPoint
+		position float64
+		distance float64
+	}{
+		{"middle", TrackPoint{Latitude: 1, Longitude: 10.5}, TrackPoint{Longitude: 10}, TrackPoint{Longitude: 11}, 0.5, MetersPerDegree()},
+		{"antimeridian", TrackPoint{Latitude: 1, Longitude: 180}, TrackPoint{Longitude: 179.5}, TrackPoint{Longitude: -179.5}, 0.5, MetersPerDegree()},
+		{"before the start", TrackPoint{Longitude: 179}, TrackPoint{Longitude: 179.5}, TrackPoint{Longitude: -179.5}, 0, MetersPerDegree() / 2},
+		{"after the end", TrackPoint{Longitude: -179}, TrackPoint{Longitude: 179.5}, TrackPoint{Longitude: -179.5}, 1, MetersPerDegree() / 2},
+		// The great circle between these points runs over the pole
+		{"pole", TrackPoint{Latitude: 90}, TrackPoint{Latitude: 89, Longitude: 0}, TrackPoint{Latitude: 89, Longitude: 180}, 0.5, 0},
+		{"start and end coincide", TrackPoint{Latitude: 1}, TrackPoint{}, TrackPoint{}, 0, MetersPerDegree()},
+	} {
+		var position, distance = projectOnLine(test.point, test.from, test.to)
+		if math.Abs(position-test.position) > 1e-6 || math.Abs(distance-test.distance) > 1 {
+			t.Errorf("%s: projected to %v at %v m, expected %v at %v m", test.name, position, distance, test.position, test.distance)
+		}
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	// Straight along the equator across the antimeridian, with GPS noise of about a
+	// meter, and a detour of 11 km
+	var track = Track{Segments: []TrackSegment{
+		{Points: []TrackPoint{
+			{Longitude: 179.8},
+			{Latitude: 0.00001, Longitude: 179.9},
+			{Longitude: 180},
+			{Latitude: -0.00001, Longitude: -179.9},
+			{Longitude: -179.8},
+		}},
+		{Points: []TrackPoint{
+			{Longitude: 179.9},
+			{Latitude: 0.1, Longitude: 180},
+			{Longitude: -179.9},
+		}},
+	}}
+
+	var simplified = track.Simplify(100)
+	if points := simplified.Segments[0].Points; len(points) != 2 || points[0].Longitude != 179.8 || points[1].Longitude != -179.8 {
+		t.Errorf("straight segment simplified to %v", points)
+	}
+	if points := simplified.Segments[1].Points; len(points) != 3 {
+		t.Errorf("detour simplified to %v", points)
+	}
+	if len(track.Segments[0].Points) != 5 {
+		t.Errorf("original track changed to %v", track.Segments[0].Points)
+	}
+
+	// Near the pole, a straight line crosses all meridians
+	track = Track{Segments: []TrackSegment{{Points: []TrackPoint{
+		{Latitude: 89.9, Longitude: 0},
+		{Latitude: 90, Longitude: 0},
+		{Latitude: 89.9, Longitude: 180},
+	}}}}
+	if points := track.Simplify(10).Segments[0].Points; len(points) != 2 {
+		t.Errorf("track over the pole simplified to %v", points)
+	}
+}
@@ -0,0 +1,82 @@
+package gpx
+
+import (
+	"strings"
+)
+
+// Language contains the codes of a language in ISO 639-1, ISO 639-2/B
+// (bibliographic) and ISO 639-2/T (terminologic)
+type Language struct {
+	Alpha2        string
+	Bibliographic string
+	Terminologic  string
+}
+
+// languages contains all languages known to BMW navigation systems
+var languages = []Language{
+	{"ar", "ara", "ara"},
+	{"bg", "bul", "bul"},
+	{"cs", "cze", "ces"},
+	{"da", "dan", "dan"},
+	{"de", "ger", "deu"},
+	{"el", "gre", "ell"},
+	{"en", "eng", "eng"},
+	{"es", "spa", "spa"},
+	{"et", "est", "est"},
+	{"fi", "fin", "fin"},
+	{"fr", "fre", "fra"},
+	{"he", "heb", "heb"},
+	{"hr", "hrv", "hrv"},
+	{"hu", "hun", "hun"},
+	{"id", "ind", "ind"},
+	{"it", "ita", "ita"},
+	{"ja", "jpn", "jpn"},
+	{"ko", "kor", "kor"},
+	{"lt", "lit", "lit"},
+	{"lv", "lav", "lav"},
+	{"nl", "dut", "nld"},
+	{"no", "nor", "nor"},
+	{"pl", "pol", "pol"},
+	{"pt", "por", "por"},
+	{"ro", "rum", "ron"},
+	{"ru", "rus", "rus"},
+	{"sk", "slo", "slk"},
+	{"sl", "slv", "slv"},
+	{"sr", "srp", "srp"},
+	{"sv", "swe", "swe"},
+	{"th", "tha", "tha"},
+	{"tr", "tur", "tur"},
+	{"uk", "ukr", "ukr"},
+	{"zh", "chi", "zho"},
+}
+
+// FindLanguage returns the language with the given ISO 639-1 or ISO 639-2 code. Region
+// subtags like in "de-AT" are ignored.
+func FindLanguage(code string) (Language, bool) {
+	var primary = primaryLanguage(code)
+	for _, language := range languages {
+		if primary == language.Alpha2 || primary == language.Bibliographic || primary == language.Terminologic {
+			return language, true
+		}
+	}
+	return Language{}, false
+}
+
+// NormalizeLanguage returns the ISO 639-1 code of a language, so that e.g. "de", "ger",
+// "deu" and "de-AT" are all the same language. Unknown codes are returned in lower
+// case without region subtag.
+func NormalizeLanguage(code string) string {
+	if language, ok := FindLanguage(code); ok {
+		return language.Alpha2
+	}
+	return primaryLanguage(code)
+}
+
+// primaryLanguage strips the region subtag, "de-AT" and "de_AT" both become "de"
+func primaryLanguage(code string) string {
+	var primary = strings.ToLower(strings.TrimSpace(code))
+	if index := strings.IndexAny(primary, "-_"); index >= 0 {
+		primary = primary[:index]
+	}
+	return primary
+}
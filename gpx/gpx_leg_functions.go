@@ -0,0 +1,65 @@
+package gpx
+
+// Leg is the part of a route between two consecutive waypoints
+type Leg struct {
+	// From and To are the indexes of the waypoints in the route
+	From int
+	To   int
+
+	// Distance in meters
+	Distance float64
+
+	// Duration in seconds
+	Duration float64
+}
+
+// CalcLegs calculates distance and duration for each leg between two consecutive
+// waypoints of the route. The waypoints are projected onto the track which matches
+// the route, as found by MatchTrack. Without a matching track, straight lines between
+// the waypoints are used.
+func (gpx GPX) CalcLegs(route Route, match TrackMatch, options DurationOptions) ([]Leg, error) {
+	var legs []Leg
+	var err error
+
+	// Track and the positions of the waypoints on it
+	var track, positions = match.Path(route)
+
+	// Loop over the legs
+	for i := 1; i < len(route.RouteWaypoints); i++ {
+		var leg = Leg{From: i - 1, To: i}
+		var section = track.slice(positions[i-1], positions[i])
+
+		leg.Distance = section.CalcDistance(options.Distance)
+		leg.Duration, err = section.CalcDuration(options)
+		if err != nil {
+			return legs, err
+		}
+
+		legs = append(legs, leg)
+	}
+
+	return legs, err
+}
+
+// slice returns the part of the track between two points, counting the points of all
+// segments. Both points are included.
+func (track Track) slice(from int, to int) Track {
+	var result Track
+	var index = 0
+
+	result.Name = track.Name
+	for _, segment := range track.Segments {
+		var part TrackSegment
+		for _, point := range segment.Points {
+			if index >= from && index <= to {
+				part.Points = append(part.Points, point)
+			}
+			index++
+		}
+		if len(part.Points) > 0 {
+			result.Segments = append(result.Segments, part)
+		}
+	}
+
+	return result
+}
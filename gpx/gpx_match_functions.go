@@ -0,0 +1,191 @@
+package gpx
+
+import "math"
+
+// Distance in meters up to which a route waypoint counts as lying on a track
+const conMatchDistance float64 = 500
+
+// Confidence below which a track is not considered to belong to a route
+const conMinMatchConfidence float64 = 0.6
+
+// TrackMatch is the track, or the part of a track, which belongs to a route
+type TrackMatch struct {
+	// TrackIndex is the index of the track in the GPX file, -1 if none matches
+	TrackIndex int
+
+	// Section is the part of the track from the first to the last waypoint
+	Section Track
+
+	// Waypoints contains for every waypoint of the route the index of the nearest
+	// point of the section, counting the points of all segments
+	Waypoints []int
+
+	// Confidence ranges from 0 (waypoints far away from the track) to 1 (all
+	// waypoints lie exactly on the track)
+	Confidence float64
+}
+
+// Matched tells if a track has been found for the route
+func (match TrackMatch) Matched() bool {
+	return match.TrackIndex >= 0
+}
+
+// MatchTrack finds the track whose geometry follows the waypoints of the route best,
+// regardless of its name. The waypoints have to be passed in the same order as the
+// track points. The section of the track between the first and the last waypoint is
+// returned, so a track may contain several routes.
+func (gpx GPX) MatchTrack(route Route) TrackMatch {
+	var best = TrackMatch{TrackIndex: -1}
+
+	// Loop over the tracks and keep the best one
+	for i, track := range gpx.Tracks {
+		section, waypoints, confidence := track.matchRoute(route)
+		if best.TrackIndex < 0 || confidence > best.Confidence {
+			best = TrackMatch{TrackIndex: i, Section: section, Waypoints: waypoints, Confidence: confidence}
+		}
+	}
+
+	if best.Confidence < conMinMatchConfidence {
+		best.TrackIndex = -1
+		best.Section = Track{}
+		best.Waypoints = nil
+	}
+	return best
+}
+
+// MatchTracks finds the matching track of every route, see MatchTrack. Matching is
+// expensive, so it is done once and the result passed to everything needing the
+// tracks of several routes.
+func (gpx GPX) MatchTracks() []TrackMatch {
+	var matches = make([]TrackMatch, len(gpx.Routes))
+	for i, route := range gpx.Routes {
+		matches[i] = gpx.MatchTrack(route)
+	}
+	return matches
+}
+
+// updateMatch matches the track of a changed route again. Functions changing routes
+// get the matches of all routes, as returned by MatchTracks, and keep them up to
+// date, so that not every route has to be matched again after every change. The
+// tracks of other routes must not have been changed.
+func (gpx GPX) updateMatch(index int, matches []TrackMatch) {
+	matches[index] = gpx.MatchTrack(gpx.Routes[index])
+}
+
+// Path returns the track the route follows and the index of the track point of every
+// waypoint: the matched section of the track or, if no track matches, straight lines
+// between the waypoints
+func (match TrackMatch) Path(route Route) (Track, []int) {
+	if match.Matched() {
+		return match.Section, match.Waypoints
+	}
+
+	var positions []int
+	for i := range route.RouteWaypoints {
+		positions = append(positions, i)
+	}
+	return route.ToTrack(), positions
+}
+
+// matchRoute assigns every waypoint of the route to a track point, keeping the
+// order of the waypoints, so that the total distance between waypoints and track
+// points is as small as possible. Returns the matched section, the index of the
+// section point assigned to each waypoint and the confidence.
+func (track Track) matchRoute(route Route) (Track, []int, float64) {
+	var section Track
+	var waypoints = route.RouteWaypoints
+
+	// All track points in a single list, remembering their segment
+	type matchPoint struct {
+		segment int
+		point   TrackPoint
+	}
+	var points []matchPoint
+	for i, segment := range track.Segments {
+		for _, point := range segment.Points {
+			points = append(points, matchPoint{i, point})
+		}
+	}
+	if len(points) == 0 || len(waypoints) == 0 {
+		return section, nil, 0
+	}
+
+	var distance = func(waypoint RouteWaypoint, point TrackPoint) float64 {
+		return approximateDistance(waypoint.Latitude, waypoint.Longitude, point.Latitude, point.Longitude)
+	}
+
+	// Dynamic programming: cost[p] is the lowest total distance if the current
+	// waypoint is assigned to track point p. Distances are capped, so that a single
+	// waypoint off the track does not spoil the whole assignment.
+	var cost = make([]float64, len(points))
+	for p := range points {
+		cost[p] = math.Min(distance(waypoints[0], points[p].point), 2*conMatchDistance)
+	}
+	var previous = make([][]int32, len(waypoints))
+	for w := 1; w < len(waypoints); w++ {
+		// The best track point for the waypoint before, at or before p
+		var bestBefore = make([]int32, len(points))
+		var bestIndex int32
+		for p := range points {
+			if cost[p] < cost[bestIndex] {
+				bestIndex = int32(p)
+			}
+			bestBefore[p] = bestIndex
+		}
+		previous[w] = bestBefore
+
+		var nextCost = make([]float64, len(points))
+		for p := range points {
+			nextCost[p] = cost[bestBefore[p]] + math.Min(distance(waypoints[w], points[p].point), 2*conMatchDistance)
+		}
+		cost = nextCost
+	}
+
+	// Follow the assignment back from the last waypoint
+	var assigned = make([]int, len(waypoints))
+	for p := range cost {
+		if cost[p] < cost[assigned[len(waypoints)-1]] {
+			assigned[len(waypoints)-1] = p
+		}
+	}
+	for w := len(waypoints) - 1; w > 0; w-- {
+		assigned[w-1] = int(previous[w][assigned[w]])
+	}
+
+	// Confidence from the real distances
+	var confidence float64
+	for w, waypoint := range waypoints {
+		confidence = confidence + math.Max(0, 1-distance(waypoint, points[assigned[w]].point)/conMatchDistance)
+	}
+	confidence = confidence / float64(len(waypoints))
+
+	// Section between the first and the last waypoint, keeping the segments
+	section.Name = track.Name
+	for p := assigned[0]; p <= assigned[len(waypoints)-1]; p++ {
+		if p == assigned[0] || points[p].segment != points[p-1].segment {
+			section.Segments = append(section.Segments, TrackSegment{})
+		}
+		var segment = &section.Segments[len(section.Segments)-1]
+		segment.Points = append(segment.Points, points[p].point)
+	}
+
+	// Positions relative to the section
+	var sectionStart = assigned[0]
+	for w := range assigned {
+		assigned[w] = assigned[w] - sectionStart
+	}
+
+	return section, assigned, confidence
+}
+
+// approximateDistance returns the distance between two close points in meters,
+// using a flat projection which is fast and accurate enough for matching. Near the
+// poles, the great circle distance is used.
+func approximateDistance(latitude1 float64, longitude1 float64, latitude2 float64, longitude2 float64) float64 {
+	if math.Abs(latitude1) > conPolarLatitude || math.Abs(latitude2) > conPolarLatitude {
+		return GreatCircleDistance(latitude1, longitude1, latitude2, longitude2)
+	}
+	var x = normalizeLongitude(longitude2-longitude1) * math.Pi / 180 * math.Cos((latitude1+latitude2)/2*math.Pi/180)
+	var y = (latitude2 - latitude1) * math.Pi / 180
+	return math.Hypot(x, y) * conEarthRadiusInMeters
+}
@@ -0,0 +1,168 @@
+package gpx
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Ways to restructure roundtrips
+const (
+	// RoundtripMidpoint makes the waypoint farthest away from the start an "always"
+	// waypoint, or adds one from the track if there is no suitable waypoint
+	RoundtripMidpoint string = "midpoint"
+
+	// RoundtripSplit splits the route into an outbound and a return route at the
+	// waypoint farthest away from the start
+	RoundtripSplit string = "split"
+)
+
+// Name of waypoints taken from the track
+const conTurningPointName string = "Turning point"
+
+// Default distance in meters between start and end up to which a route is a roundtrip
+const conDefaultRoundtripRadius float64 = 200
+
+// RoundtripOptions controls how roundtrips are detected and restructured
+type RoundtripOptions struct {
+	// Radius in meters, if start and end of a route are closer, it is a roundtrip.
+	// 0 means 200 meters.
+	Radius float64
+
+	// Mode is RoundtripMidpoint or RoundtripSplit
+	Mode string
+}
+
+// IsAlways tells if the navigation system has to stop at a waypoint of the route.
+// This is the case for the first and the last waypoint and all marked as Always.
+func (route Route) IsAlways(index int) bool {
+	return index == 0 || index == len(route.RouteWaypoints)-1 || route.RouteWaypoints[index].Always
+}
+
+// IsRoundtrip tells if start and end of the route are closer than the radius
+func (route Route) IsRoundtrip(radius float64) bool {
+	if radius <= 0 {
+		radius = conDefaultRoundtripRadius
+	}
+	if len(route.RouteWaypoints) < 2 {
+		return false
+	}
+	var start = route.RouteWaypoints[0]
+	var end = route.RouteWaypoints[len(route.RouteWaypoints)-1]
+	return approximateDistance(start.Latitude, start.Longitude, end.Latitude, end.Longitude) <= radius
+}
+
+// RestructureRoundtrips changes routes whose start and end coincide, because the
+// navigation system would plan a route of zero length for them. The matches of all
+// routes are passed, as returned by MatchTracks. Splitting adds routes, so they have
+// to be matched again if anything changed. Returns a description of every change.
+func (gpx *GPX) RestructureRoundtrips(matches []TrackMatch, options RoundtripOptions) ([]string, error) {
+	var changes []string
+	var err error
+
+	if options.Mode != RoundtripMidpoint && options.Mode != RoundtripSplit {
+		return changes, errors.New("unknown roundtrip mode \"" + options.Mode + "\"")
+	}
+
+	// Loop over the routes. Splitting adds routes, so we build a new list.
+	var routes []Route
+	for i, route := range gpx.Routes {
+		var prefix = "Route " + strconv.Itoa(i+1) + " \"" + route.Name + "\" is a roundtrip: "
+		if !route.IsRoundtrip(options.Radius) {
+			routes = append(routes, route)
+			continue
+		}
+
+		// The waypoint farthest away from the start, which may have to be taken
+		// from the track
+		waypoints, far, inserted := farthestWaypoint(route, matches[i])
+		route.RouteWaypoints = waypoints
+		if far <= 0 || far >= len(route.RouteWaypoints)-1 {
+			changes = append(changes, prefix+"no waypoint away from the start found, left unchanged")
+			routes = append(routes, route)
+			continue
+		}
+		if inserted {
+			changes = append(changes, prefix+"added a waypoint from the track at "+strconv.FormatFloat(route.RouteWaypoints[far].Latitude, 'f', 6, 64)+", "+strconv.FormatFloat(route.RouteWaypoints[far].Longitude, 'f', 6, 64))
+		}
+
+		var start = route.RouteWaypoints[0]
+		var farWaypoint = route.RouteWaypoints[far]
+		var distance = strconv.FormatFloat(approximateDistance(start.Latitude, start.Longitude, farWaypoint.Latitude, farWaypoint.Longitude)/1000, 'f', 1, 64)
+		var waypointName = "waypoint " + strconv.Itoa(far+1) + " \"" + farWaypoint.Name + "\" (" + distance + " km from the start)"
+
+		if options.Mode == RoundtripSplit {
+			// Outbound and return route share the waypoint
+			var outbound = route
+			var inbound = route
+			outbound.Name = route.Name + " (outbound)"
+			outbound.RouteWaypoints = append([]RouteWaypoint(nil), route.RouteWaypoints[:far+1]...)
+			inbound.Name = route.Name + " (return)"
+			inbound.RouteWaypoints = append([]RouteWaypoint(nil), route.RouteWaypoints[far:]...)
+			routes = append(routes, outbound, inbound)
+			changes = append(changes, prefix+"split into an outbound and a return route at "+waypointName)
+		} else {
+			route.RouteWaypoints[far].Always = true
+			routes = append(routes, route)
+			changes = append(changes, prefix+"the navigation system now stops at "+waypointName)
+		}
+	}
+	gpx.Routes = routes
+
+	return changes, err
+}
+
+// farthestWaypoint returns the index of the waypoint farthest away from the start of
+// the route. If the track of the route goes much farther away than all waypoints,
+// its farthest point is inserted as new waypoint. Returns the waypoints including
+// the inserted one, the index and if a waypoint has been inserted.
+func farthestWaypoint(route Route, match TrackMatch) ([]RouteWaypoint, int, bool) {
+	var waypoints = route.RouteWaypoints
+	var start = waypoints[0]
+
+	// Farthest waypoint
+	var far = -1
+	var farDistance float64
+	for i := 1; i < len(waypoints)-1; i++ {
+		var distance = approximateDistance(start.Latitude, start.Longitude, waypoints[i].Latitude, waypoints[i].Longitude)
+		if distance > farDistance {
+			far = i
+			farDistance = distance
+		}
+	}
+
+	// Farthest track point
+	if !match.Matched() {
+		return waypoints, far, false
+	}
+	var points []TrackPoint
+	for _, segment := range match.Section.Segments {
+		points = append(points, segment.Points...)
+	}
+	var farPoint = -1
+	var farPointDistance float64
+	for i, point := range points {
+		var distance = approximateDistance(start.Latitude, start.Longitude, point.Latitude, point.Longitude)
+		if distance > farPointDistance {
+			farPoint = i
+			farPointDistance = distance
+		}
+	}
+	if farPoint < 0 || farPointDistance <= 2*farDistance {
+		return waypoints, far, false
+	}
+
+	// Insert the track point behind the last waypoint before it
+	var position = 1
+	for i := 1; i < len(waypoints)-1; i++ {
+		if match.Waypoints[i] <= farPoint {
+			position = i + 1
+		}
+	}
+	var waypoint = RouteWaypoint{Name: conTurningPointName, Latitude: points[farPoint].Latitude, Longitude: points[farPoint].Longitude, Elevation: points[farPoint].Elevation}
+	var result []RouteWaypoint
+	result = append(result, waypoints[:position]...)
+	result = append(result, waypoint)
+	result = append(result, waypoints[position:]...)
+
+	return result, position, true
+}
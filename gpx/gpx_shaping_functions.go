@@ -0,0 +1,251 @@
+package gpx
+
+import (
+	"math"
+	"sort"
+)
+
+// Defaults for shaping waypoints
+const conDefaultShapingBudget int = 25
+const conDefaultShapingTolerance float64 = 300
+const conDefaultShapingTurn float64 = 60
+const conDefaultShapingSpacing float64 = 10000
+
+// Distance in meters before and behind a point used to measure turns
+const conTurnWindow float64 = 100
+
+// Minimum distance in meters along the track between two waypoints
+const conMinWaypointGap float64 = 500
+
+// Name of waypoints added to shape the route
+const conShapingPointName string = "Shaping point"
+
+// ShapingOptions controls how waypoints are taken from the track, so that the
+// navigation system follows the intended roads
+type ShapingOptions struct {
+	// MaxWaypoints per route, including the existing ones. 0 means 25.
+	MaxWaypoints int
+
+	// Tolerance in meters the track may leave the straight line between two
+	// waypoints. 0 means 300 meters.
+	Tolerance float64
+
+	// Turn in degrees from which on a change of direction gets a waypoint. 0 means
+	// 60 degrees.
+	Turn float64
+
+	// Spacing in meters, longer distances between waypoints are split. 0 means 10 km.
+	Spacing float64
+}
+
+// AddShapingWaypoints adds optional waypoints from the matching track to every route,
+// at places which define the roads to take: where the track leaves the straight
+// line between two waypoints, at sharp turns and, as a fallback, at a fixed spacing.
+// The matches of all routes are passed, as returned by MatchTracks, and updated for
+// the changed routes. Returns the number of waypoints added per route.
+func (gpx *GPX) AddShapingWaypoints(matches []TrackMatch, options ShapingOptions) []int {
+	var added = make([]int, len(gpx.Routes))
+
+	if options.MaxWaypoints <= 0 {
+		options.MaxWaypoints = conDefaultShapingBudget
+	}
+	if options.Tolerance <= 0 {
+		options.Tolerance = conDefaultShapingTolerance
+	}
+	if options.Turn <= 0 {
+		options.Turn = conDefaultShapingTurn
+	}
+	if options.Spacing <= 0 {
+		options.Spacing = conDefaultShapingSpacing
+	}
+
+	// Loop over the routes
+	for i := range gpx.Routes {
+		var route = &gpx.Routes[i]
+		var match = matches[i]
+		if !match.Matched() || len(route.RouteWaypoints) >= options.MaxWaypoints {
+			continue
+		}
+
+		var points []TrackPoint
+		for _, segment := range match.Section.Segments {
+			points = append(points, segment.Points...)
+		}
+		var shaper = newShaper(points, match.Waypoints, options.MaxWaypoints-len(route.RouteWaypoints))
+
+		shaper.addDeviations(options.Tolerance)
+		shaper.addTurns(options.Turn)
+		shaper.addSpacing(options.Spacing)
+
+		// Merge the new waypoints into the route, ordered along the track
+		var waypoints []RouteWaypoint
+		var next = 0
+		for j, waypoint := range route.RouteWaypoints {
+			for next < len(shaper.added) && shaper.added[next] < match.Waypoints[j] {
+				waypoints = append(waypoints, shaper.waypoint(shaper.added[next]))
+				next++
+			}
+			waypoints = append(waypoints, waypoint)
+		}
+		route.RouteWaypoints = waypoints
+		added[i] = len(shaper.added)
+		if added[i] > 0 {
+			gpx.updateMatch(i, matches)
+		}
+	}
+
+	return added
+}
+
+// shaper selects track points as waypoints
+type shaper struct {
+	points    []TrackPoint
+	distances []float64
+	chosen    []int
+	added     []int
+	budget    int
+}
+
+// newShaper prepares the selection of up to budget waypoints from the track points
+func newShaper(points []TrackPoint, waypoints []int, budget int) *shaper {
+	var s = shaper{points: points, budget: budget}
+	s.distances = make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		s.distances[i] = s.distances[i-1] + approximateDistance(points[i-1].Latitude, points[i-1].Longitude, points[i].Latitude, points[i].Longitude)
+	}
+	s.chosen = append(s.chosen, waypoints...)
+	sort.Ints(s.chosen)
+	return &s
+}
+
+// add chooses a track point as new waypoint, unless it is too close to another one
+func (s *shaper) add(point int) bool {
+	if len(s.added) >= s.budget {
+		return false
+	}
+	var position = sort.SearchInts(s.chosen, point)
+	if position < len(s.chosen) && s.distances[s.chosen[position]]-s.distances[point] < conMinWaypointGap {
+		return false
+	}
+	if position > 0 && s.distances[point]-s.distances[s.chosen[position-1]] < conMinWaypointGap {
+		return false
+	}
+
+	s.chosen = append(s.chosen[:position], append([]int{point}, s.chosen[position:]...)...)
+	position = sort.SearchInts(s.added, point)
+	s.added = append(s.added[:position], append([]int{point}, s.added[position:]...)...)
+	return true
+}
+
+// addDeviations adds the point farthest away from the straight line between two
+// waypoints, as long as it is farther away than the tolerance
+func (s *shaper) addDeviations(tolerance float64) {
+	var rejected = make(map[int]bool)
+	for len(s.added) < s.budget {
+		var best = -1
+		var bestDeviation = tolerance
+		for c := 1; c < len(s.chosen); c++ {
+			var from = s.points[s.chosen[c-1]]
+			var to = s.points[s.chosen[c]]
+			for p := s.chosen[c-1] + 1; p < s.chosen[c]; p++ {
+				if rejected[p] {
+					continue
+				}
+				var deviation = distanceToLine(s.points[p], from, to)
+				if deviation > bestDeviation {
+					best = p
+					bestDeviation = deviation
+				}
+			}
+		}
+		if best < 0 {
+			return
+		}
+		if !s.add(best) {
+			rejected[best] = true
+		}
+	}
+}
+
+// addTurns adds the points where the track changes its direction the most
+func (s *shaper) addTurns(minTurn float64) {
+	type turn struct {
+		point int
+		angle float64
+	}
+	var turns []turn
+
+	// The direction is measured between points about conTurnWindow before and
+	// behind each point, so that small wiggles do not count
+	var before = 0
+	var behind = 0
+	for p := range s.points {
+		for s.distances[p]-s.distances[before] > conTurnWindow {
+			before++
+		}
+		for behind < len(s.points)-1 && s.distances[behind]-s.distances[p] < conTurnWindow {
+			behind++
+		}
+		if before == p || behind == p {
+			continue
+		}
+		var bearingIn = bearing(s.points[before].Latitude, s.points[before].Longitude, s.points[p].Latitude, s.points[p].Longitude)
+		var bearingOut = bearing(s.points[p].Latitude, s.points[p].Longitude, s.points[behind].Latitude, s.points[behind].Longitude)
+		var angle = math.Abs(bearingOut - bearingIn)
+		if angle > 180 {
+			angle = 360 - angle
+		}
+		if angle >= minTurn {
+			turns = append(turns, turn{p, angle})
+		}
+	}
+
+	// Sharpest turns first
+	sort.SliceStable(turns, func(i int, j int) bool {
+		return turns[i].angle > turns[j].angle
+	})
+	for _, t := range turns {
+		if len(s.added) >= s.budget {
+			return
+		}
+		s.add(t.point)
+	}
+}
+
+// addSpacing splits the longest distances between two waypoints, until all of them
+// are shorter than the spacing
+func (s *shaper) addSpacing(spacing float64) {
+	for len(s.added) < s.budget {
+		var longest = -1
+		var longestDistance = spacing
+		for c := 1; c < len(s.chosen); c++ {
+			var distance = s.distances[s.chosen[c]] - s.distances[s.chosen[c-1]]
+			if distance > longestDistance {
+				longest = c
+				longestDistance = distance
+			}
+		}
+		if longest < 0 {
+			return
+		}
+
+		// Track point in the middle
+		var middle = s.distances[s.chosen[longest-1]] + longestDistance/2
+		var point = sort.SearchFloat64s(s.distances, middle)
+		if point <= s.chosen[longest-1] || point >= s.chosen[longest] || !s.add(point) {
+			return
+		}
+	}
+}
+
+// waypoint returns an optional waypoint at the track point
+func (s *shaper) waypoint(point int) RouteWaypoint {
+	return RouteWaypoint{Name: conShapingPointName, Latitude: s.points[point].Latitude, Longitude: s.points[point].Longitude, Elevation: s.points[point].Elevation}
+}
+
+// distanceToLine returns the distance in meters between a point and the straight
+// line between two other points
+func distanceToLine(point TrackPoint, from TrackPoint, to TrackPoint) float64 {
+	var _, distance = projectOnLine(point, from, to)
+	return distance
+}
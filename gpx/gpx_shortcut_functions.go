@@ -0,0 +1,188 @@
+package gpx
+
+import "math"
+
+// Default thresholds to detect shortcuts
+const conDefaultShortcutRatio float64 = 3
+const conDefaultShortcutMinDistance float64 = 2000
+
+// Name of waypoints added to prevent shortcuts
+const conViaPointName string = "Via point"
+
+// Number of times the route is checked again after adding waypoints
+const conMaxShortcutPasses int = 10
+
+// ShortcutOptions controls when a shortcut is considered likely
+type ShortcutOptions struct {
+	// Ratio between the distance along the route and the straight distance from
+	// which on a shortcut is likely. 0 means 3.
+	Ratio float64
+
+	// MinDistance in meters the shortcut has to save at least. 0 means 2 km.
+	MinDistance float64
+}
+
+// ShortcutRisk is a place where the navigation system will probably leave the
+// route, because a waypoint it has to stop at is much closer in a straight line
+// than along the route
+type ShortcutRisk struct {
+	// Route and Waypoint are the indexes of the waypoint at risk, Destination is a
+	// copy of it, as the indexes change when waypoints are added
+	Route       int
+	Waypoint    int
+	Destination RouteWaypoint
+
+	// Latitude and Longitude of the point of the route the shortcut starts at
+	Latitude  float64
+	Longitude float64
+
+	// StraightDistance and RouteDistance in meters between this point and the
+	// waypoint
+	StraightDistance float64
+	RouteDistance    float64
+
+	// Suggestion is a waypoint which prevents the shortcut if the navigation system
+	// has to stop at it. It belongs in front of the waypoint SuggestionIndex.
+	Suggestion      RouteWaypoint
+	SuggestionIndex int
+}
+
+// FindShortcutRisks checks every waypoint the navigation system has to stop at
+// against the route leading to it from the waypoint before. If a point of the route
+// is much closer to the waypoint in a straight line than along the route, the
+// navigation system will probably take a shortcut. Roads are not known, so only the
+// straight distance is used. The matches of all routes are passed, as returned by
+// MatchTracks.
+func (gpx GPX) FindShortcutRisks(matches []TrackMatch, options ShortcutOptions) []ShortcutRisk {
+	var risks []ShortcutRisk
+	for i := range gpx.Routes {
+		risks = append(risks, gpx.findRouteShortcutRisks(i, matches[i], options)...)
+	}
+	return risks
+}
+
+// PreventShortcuts adds waypoints the navigation system has to stop at, until no
+// more shortcuts are found. The matches of all routes are passed, as returned by
+// MatchTracks, and updated for the changed routes. Returns the risks which have been
+// fixed.
+func (gpx *GPX) PreventShortcuts(matches []TrackMatch, options ShortcutOptions) []ShortcutRisk {
+	var fixed []ShortcutRisk
+
+	for i := range gpx.Routes {
+		// Every added waypoint changes the route, so we check it again
+		for pass := 0; pass < conMaxShortcutPasses; pass++ {
+			var risks = gpx.findRouteShortcutRisks(i, matches[i], options)
+			if len(risks) == 0 {
+				break
+			}
+
+			// Insert from the back, so that the indexes stay valid
+			var route = &gpx.Routes[i]
+			for j := len(risks) - 1; j >= 0; j-- {
+				var risk = risks[j]
+				var waypoints []RouteWaypoint
+				waypoints = append(waypoints, route.RouteWaypoints[:risk.SuggestionIndex]...)
+				waypoints = append(waypoints, risk.Suggestion)
+				waypoints = append(waypoints, route.RouteWaypoints[risk.SuggestionIndex:]...)
+				route.RouteWaypoints = waypoints
+			}
+			gpx.updateMatch(i, matches)
+			fixed = append(fixed, risks...)
+		}
+	}
+
+	return fixed
+}
+
+// findRouteShortcutRisks checks a single route, returning at most one risk per
+// waypoint
+func (gpx GPX) findRouteShortcutRisks(routeIndex int, match TrackMatch, options ShortcutOptions) []ShortcutRisk {
+	var risks []ShortcutRisk
+	var route = gpx.Routes[routeIndex]
+
+	if options.Ratio <= 0 {
+		options.Ratio = conDefaultShortcutRatio
+	}
+	if options.MinDistance <= 0 {
+		options.MinDistance = conDefaultShortcutMinDistance
+	}
+
+	// Points of the route and their distance from the start
+	var track, positions = match.Path(route)
+	var points []TrackPoint
+	for _, segment := range track.Segments {
+		points = append(points, segment.Points...)
+	}
+	if len(points) == 0 || len(positions) != len(route.RouteWaypoints) {
+		return risks
+	}
+	var distances = make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		distances[i] = distances[i-1] + approximateDistance(points[i-1].Latitude, points[i-1].Longitude, points[i].Latitude, points[i].Longitude)
+	}
+
+	// Loop over the waypoints the navigation system has to stop at, checking the
+	// route since the one before
+	var previous = 0
+	for w := 1; w < len(route.RouteWaypoints); w++ {
+		if !route.IsAlways(w) {
+			continue
+		}
+		var target = route.RouteWaypoints[w]
+		var from = positions[previous]
+		var to = positions[w]
+
+		// The point with the largest detour to the waypoint
+		var worst = -1
+		var worstRatio float64
+		for p := from; p < to; p++ {
+			var straight = approximateDistance(points[p].Latitude, points[p].Longitude, target.Latitude, target.Longitude)
+			var along = distances[to] - distances[p]
+			if along-straight < options.MinDistance {
+				continue
+			}
+			var ratio = along / math.Max(straight, 1)
+			if ratio >= options.Ratio && ratio > worstRatio {
+				worst = p
+				worstRatio = ratio
+			}
+		}
+
+		if worst >= 0 {
+			var risk = ShortcutRisk{Route: routeIndex, Waypoint: w, Destination: target}
+			risk.Latitude = points[worst].Latitude
+			risk.Longitude = points[worst].Longitude
+			risk.StraightDistance = approximateDistance(points[worst].Latitude, points[worst].Longitude, target.Latitude, target.Longitude)
+			risk.RouteDistance = distances[to] - distances[worst]
+
+			// The point of the detour farthest away from both ends blocks the
+			// shortcut
+			var block = worst
+			var blockDistance float64
+			for p := worst; p < to; p++ {
+				var distance = math.Min(
+					approximateDistance(points[p].Latitude, points[p].Longitude, points[worst].Latitude, points[worst].Longitude),
+					approximateDistance(points[p].Latitude, points[p].Longitude, target.Latitude, target.Longitude))
+				if distance > blockDistance {
+					block = p
+					blockDistance = distance
+				}
+			}
+			risk.Suggestion = RouteWaypoint{Name: conViaPointName, Latitude: points[block].Latitude, Longitude: points[block].Longitude, Elevation: points[block].Elevation, Always: true}
+
+			// Behind the last waypoint before the blocking point
+			risk.SuggestionIndex = w
+			for i := w - 1; i > previous; i-- {
+				if positions[i] > block {
+					risk.SuggestionIndex = i
+				}
+			}
+
+			risks = append(risks, risk)
+		}
+
+		previous = w
+	}
+
+	return risks
+}
@@ -0,0 +1,165 @@
+package gpx
+
+import (
+	"math"
+	"strconv"
+)
+
+// Default distance in meters from which on a waypoint does not belong to a track
+const conDefaultDivergenceDistance float64 = 1000
+
+// Distance in meters up to which a waypoint already lies on the track
+const conSnapTolerance float64 = 1
+
+// SnapOptions controls how waypoints are moved onto the tracks
+type SnapOptions struct {
+	// MaxDistance in meters a waypoint may be away from a track. Waypoints farther
+	// away are reported as divergence and never moved. 0 means 1000 meters.
+	MaxDistance float64
+}
+
+// WaypointOffset is the distance between a route waypoint and a track
+type WaypointOffset struct {
+	// Route and Waypoint are the indexes of the waypoint
+	Route    int
+	Waypoint int
+
+	// Track is the index of the nearest track, -1 if the GPX file has no tracks
+	Track int
+
+	// Distance in meters between the waypoint and the nearest point of the track
+	Distance float64
+}
+
+// FindDivergences returns the route waypoints which are farther away from every
+// track than MaxDistance. This usually means that route and track disagree. Without
+// any tracks, nothing is returned.
+func (gpx GPX) FindDivergences(options SnapOptions) []WaypointOffset {
+	var divergences []WaypointOffset
+
+	if options.MaxDistance <= 0 {
+		options.MaxDistance = conDefaultDivergenceDistance
+	}
+
+	// Loop over all route waypoints
+	for r, route := range gpx.Routes {
+		for w, waypoint := range route.RouteWaypoints {
+			var offset = WaypointOffset{Route: r, Waypoint: w, Track: -1, Distance: math.Inf(1)}
+			for t, track := range gpx.Tracks {
+				var _, distance = track.nearestPoint(waypoint.Latitude, waypoint.Longitude, 0, math.MaxInt32)
+				if distance < offset.Distance {
+					offset.Track = t
+					offset.Distance = distance
+				}
+			}
+			if offset.Track >= 0 && offset.Distance > options.MaxDistance {
+				divergences = append(divergences, offset)
+			}
+		}
+	}
+
+	return divergences
+}
+
+// SnapWaypoints moves every route waypoint to the nearest point of the track which
+// belongs to the route, as found by MatchTracks. The original position is kept in
+// the description of the waypoint. Waypoints farther away from the track than
+// MaxDistance are left alone. The matches of moved routes are updated. Returns the
+// waypoints which have been moved.
+func (gpx *GPX) SnapWaypoints(matches []TrackMatch, options SnapOptions) []WaypointOffset {
+	var snapped []WaypointOffset
+
+	if options.MaxDistance <= 0 {
+		options.MaxDistance = conDefaultDivergenceDistance
+	}
+
+	// Loop over the routes
+	for r := range gpx.Routes {
+		var route = &gpx.Routes[r]
+		var match = matches[r]
+		if !match.Matched() {
+			continue
+		}
+
+		var moved = false
+		for w := range route.RouteWaypoints {
+			var waypoint = &route.RouteWaypoints[w]
+
+			// Only the part of the track between the waypoints before and after is
+			// searched, so that the order of the waypoints is kept
+			var from = 0
+			var to = math.MaxInt32
+			if w > 0 {
+				from = match.Waypoints[w-1]
+			}
+			if w < len(route.RouteWaypoints)-1 {
+				to = match.Waypoints[w+1]
+			}
+			var point, distance = match.Section.nearestPoint(waypoint.Latitude, waypoint.Longitude, from, to)
+			if distance <= conSnapTolerance || distance > options.MaxDistance {
+				continue
+			}
+
+			// The address may have been taken from the description, which changes now
+			if waypoint.Address.IsEmpty() {
+				waypoint.Address = waypoint.GetAddress()
+			}
+			var original = "Original position: " + strconv.FormatFloat(waypoint.Latitude, 'f', 6, 64) + ", " + strconv.FormatFloat(waypoint.Longitude, 'f', 6, 64)
+			if waypoint.Description == "" {
+				waypoint.Description = original
+			} else {
+				waypoint.Description = waypoint.Description + "\n" + original
+			}
+
+			waypoint.Latitude = roundCoordinate(point.Latitude)
+			waypoint.Longitude = roundCoordinate(point.Longitude)
+			waypoint.Elevation = point.Elevation
+			snapped = append(snapped, WaypointOffset{Route: r, Waypoint: w, Track: match.TrackIndex, Distance: distance})
+			moved = true
+		}
+		if moved {
+			gpx.updateMatch(r, matches)
+		}
+	}
+
+	return snapped
+}
+
+// nearestPoint returns the point of the track closest to the given position, which
+// may lie between two track points, and its distance in meters. Only the lines
+// between the track points from and to are searched, counting the points of all
+// segments.
+func (track Track) nearestPoint(latitude float64, longitude float64, from int, to int) (TrackPoint, float64) {
+	var nearest TrackPoint
+	var nearestDistance = math.Inf(1)
+	var position = TrackPoint{Latitude: latitude, Longitude: longitude}
+
+	// Loop over the lines between two track points of a segment
+	var index = 0
+	for _, segment := range track.Segments {
+		for i := range segment.Points {
+			if index >= from && index <= to {
+				var start = segment.Points[i]
+				var end = start
+				if i+1 < len(segment.Points) && index+1 <= to {
+					end = segment.Points[i+1]
+				}
+				var t, distance = projectOnLine(position, start, end)
+				if distance < nearestDistance {
+					nearestDistance = distance
+					nearest = interpolatePoint(start, end, t)
+					nearest.Elevation = start.Elevation + t*(end.Elevation-start.Elevation)
+				}
+			}
+			index++
+		}
+	}
+
+	return nearest, nearestDistance
+}
+
+// roundCoordinate rounds a coordinate calculated between two track points to about
+// 0.1 meters, which is more precise than GPS anyway
+func roundCoordinate(value float64) float64 {
+	return math.Round(value*1e6) / 1e6
+}
@@ -0,0 +1,227 @@
+package gpx
+
+import "math"
+
+// Thresholds for the statistics
+const conStatsSpacing float64 = 25
+const conElevationHysteresis float64 = 5
+const conGradientWindow float64 = 100
+const conHairpinWindow float64 = 200
+const conHairpinTurn float64 = 150
+const conStraightCurvature float64 = 5
+
+// Stats contains statistics about the geometry of a track or route
+type Stats struct {
+	// Distance in meters
+	Distance float64 `json:"distance"`
+
+	// Bounding box in degrees. If it crosses the antimeridian, MinLongitude (the
+	// western edge) is greater than MaxLongitude (the eastern edge).
+	MinLatitude  float64 `json:"minLatitude"`
+	MinLongitude float64 `json:"minLongitude"`
+	MaxLatitude  float64 `json:"maxLatitude"`
+	MaxLongitude float64 `json:"maxLongitude"`
+
+	// HasElevation is false if all elevations are 0, the following fields are 0
+	// then as well
+	HasElevation bool `json:"hasElevation"`
+
+	// Ascent and Descent in meters, small ups and downs are ignored
+	Ascent  float64 `json:"ascent"`
+	Descent float64 `json:"descent"`
+
+	// MaxGradient in percent, measured over 100 meters, uphill or downhill
+	MaxGradient float64 `json:"maxGradient"`
+
+	// Highest and lowest point
+	HighestPoint StatsPoint `json:"highestPoint"`
+	LowestPoint  StatsPoint `json:"lowestPoint"`
+
+	// Hairpins is the number of turns by more than 150 degrees within 200 meters
+	Hairpins int `json:"hairpins"`
+
+	// Twistiness is the change of direction in degrees per kilometer
+	Twistiness float64 `json:"twistiness"`
+
+	// StraightShare is the part of the distance on straight sections, from 0 to 1
+	StraightShare float64 `json:"straightShare"`
+}
+
+// StatsPoint is a point of a track mentioned in the statistics
+type StatsPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Elevation float64 `json:"elevation"`
+}
+
+// CalcStats calculates statistics about the geometry of the track
+func (track Track) CalcStats(options DistanceOptions) Stats {
+	var stats Stats
+	var turnSum, straightDistance float64
+	var longitudes []float64
+	var first = true
+
+	// We have to loop over the track segments
+	for _, segment := range track.Segments {
+		if len(segment.Points) == 0 {
+			continue
+		}
+		stats.Distance = stats.Distance + Track{Segments: []TrackSegment{segment}}.CalcDistance(options)
+
+		// Bounding box, highest and lowest point
+		var elevationOptions = options
+		elevationOptions.TwoDimensional = false
+		var elevations = segment.elevations(elevationOptions)
+		for i, trackPoint := range segment.Points {
+			var point = StatsPoint{trackPoint.Latitude, trackPoint.Longitude, elevations[i]}
+			if first {
+				stats.MinLatitude, stats.MaxLatitude = point.Latitude, point.Latitude
+				stats.HighestPoint, stats.LowestPoint = point, point
+				first = false
+			}
+			stats.MinLatitude = math.Min(stats.MinLatitude, point.Latitude)
+			stats.MaxLatitude = math.Max(stats.MaxLatitude, point.Latitude)
+			longitudes = append(longitudes, point.Longitude)
+			if point.Elevation > stats.HighestPoint.Elevation {
+				stats.HighestPoint = point
+			}
+			if point.Elevation < stats.LowestPoint.Elevation {
+				stats.LowestPoint = point
+			}
+			if point.Elevation != 0 {
+				stats.HasElevation = true
+			}
+		}
+
+		// Points at least conStatsSpacing apart, so that GPS noise does not count as
+		// curves or climbs
+		var points = []TrackPoint{segment.Points[0]}
+		var pointElevations = []float64{elevations[0]}
+		var positions = []float64{0}
+		var position float64
+		for i := 1; i < len(segment.Points); i++ {
+			var last = points[len(points)-1]
+			var distance = pointDistance(last.Latitude, last.Longitude, 0, segment.Points[i].Latitude, segment.Points[i].Longitude, 0, DistanceOptions{Method: options.Method, TwoDimensional: true})
+			if distance >= conStatsSpacing || i == len(segment.Points)-1 && distance > 0 {
+				position = position + distance
+				points = append(points, segment.Points[i])
+				pointElevations = append(pointElevations, elevations[i])
+				positions = append(positions, position)
+			}
+		}
+
+		// Ascent and descent, counting a change only once it exceeds the hysteresis
+		var reference = pointElevations[0]
+		for _, elevation := range pointElevations {
+			if elevation-reference >= conElevationHysteresis {
+				stats.Ascent = stats.Ascent + elevation - reference
+				reference = elevation
+			} else if reference-elevation >= conElevationHysteresis {
+				stats.Descent = stats.Descent + reference - elevation
+				reference = elevation
+			}
+		}
+
+		// Maximum gradient over conGradientWindow
+		var ahead = 0
+		for i := range points {
+			for ahead < len(points)-1 && positions[ahead]-positions[i] < conGradientWindow {
+				ahead++
+			}
+			if positions[ahead]-positions[i] >= conGradientWindow {
+				var gradient = math.Abs(pointElevations[ahead]-pointElevations[i]) / (positions[ahead] - positions[i]) * 100
+				stats.MaxGradient = math.Max(stats.MaxGradient, gradient)
+			}
+		}
+
+		// Signed change of direction at every point
+		var turns = make([]float64, len(points))
+		for i := 1; i < len(points)-1; i++ {
+			var bearingIn = bearing(points[i-1].Latitude, points[i-1].Longitude, points[i].Latitude, points[i].Longitude)
+			var bearingOut = bearing(points[i].Latitude, points[i].Longitude, points[i+1].Latitude, points[i+1].Longitude)
+			turns[i] = math.Mod(bearingOut-bearingIn+540, 360) - 180
+			turnSum = turnSum + math.Abs(turns[i])
+		}
+
+		// Hairpins: the direction changes by conHairpinTurn within conHairpinWindow
+		var start = 0
+		var signedSum float64
+		for i := range points {
+			signedSum = signedSum + turns[i]
+			for positions[i]-positions[start] > conHairpinWindow {
+				signedSum = signedSum - turns[start]
+				start++
+			}
+			if math.Abs(signedSum) >= conHairpinTurn {
+				stats.Hairpins++
+				signedSum = 0
+				start = i + 1
+			}
+		}
+
+		// Straight sections: legs with little change of direction around them
+		var from = 0
+		var to = 0
+		var windowSum float64
+		for i := 1; i < len(points); i++ {
+			var middle = (positions[i-1] + positions[i]) / 2
+			for to < len(points) && positions[to] <= middle+conCurvatureWindow/2 {
+				windowSum = windowSum + math.Abs(turns[to])
+				to++
+			}
+			for positions[from] < middle-conCurvatureWindow/2 {
+				windowSum = windowSum - math.Abs(turns[from])
+				from++
+			}
+			if windowSum/conCurvatureWindow*100 < conStraightCurvature {
+				straightDistance = straightDistance + positions[i] - positions[i-1]
+			}
+		}
+	}
+
+	stats.MinLongitude, stats.MaxLongitude = LongitudeRange(longitudes)
+
+	// Without elevations, the elevation statistics are meaningless
+	if !stats.HasElevation {
+		stats.Ascent, stats.Descent, stats.MaxGradient = 0, 0, 0
+		stats.HighestPoint, stats.LowestPoint = StatsPoint{}, StatsPoint{}
+	}
+
+	if stats.Distance > 0 {
+		stats.Twistiness = turnSum / stats.Distance * 1000
+		stats.StraightShare = math.Min(1, straightDistance/stats.Distance)
+	}
+
+	return stats
+}
+
+// CalcStats calculates statistics about the geometry of the straight lines between
+// the waypoints of the route. See GPX.CalcRouteStats to use the track of the route.
+func (route Route) CalcStats(options DistanceOptions) Stats {
+	return route.ToTrack().CalcStats(options)
+}
+
+// CalcRouteStats calculates statistics about the route, using the track which
+// matches it, as found by MatchTrack
+func (gpx GPX) CalcRouteStats(route Route, match TrackMatch, options DistanceOptions) Stats {
+	var track, _ = match.Path(route)
+	return track.CalcStats(options)
+}
+
+// CalcStats calculates statistics about all routes of the GPX file together, or
+// about all tracks if there are no routes. The matches contain the track of every
+// route, as returned by MatchTracks.
+func (gpx GPX) CalcStats(matches []TrackMatch, options DistanceOptions) Stats {
+	var combined Track
+	if len(gpx.Routes) > 0 {
+		for i, route := range gpx.Routes {
+			var track, _ = matches[i].Path(route)
+			combined.Segments = append(combined.Segments, track.Segments...)
+		}
+	} else {
+		for _, track := range gpx.Tracks {
+			combined.Segments = append(combined.Segments, track.Segments...)
+		}
+	}
+	return combined.CalcStats(options)
+}
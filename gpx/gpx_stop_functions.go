@@ -0,0 +1,103 @@
+package gpx
+
+import (
+	"time"
+)
+
+// Default thresholds to detect stops
+const conDefaultStopSpeed float64 = 3
+const conDefaultStopDuration time.Duration = 3 * time.Minute
+
+// StopOptions controls how stops are detected in recorded tracks
+type StopOptions struct {
+	// MaxSpeed in km/h below which the vehicle is considered standing, 0 means 3 km/h
+	MaxSpeed float64
+
+	// MinDuration of a stop, shorter ones like traffic lights count as moving time.
+	// 0 means 3 minutes.
+	MinDuration time.Duration
+}
+
+// Stop is a break found in a recorded track
+type Stop struct {
+	Latitude  float64
+	Longitude float64
+	Start     time.Time
+	End       time.Time
+}
+
+// Duration returns how long the stop took
+func (stop Stop) Duration() time.Duration {
+	return stop.End.Sub(stop.Start)
+}
+
+// CalcMovingTime calculates the time spent moving in seconds, based on the
+// timestamps of the track, and returns the stops which have been left out. Track
+// points without timestamp are ignored.
+func (track Track) CalcMovingTime(options StopOptions) (int64, []Stop, error) {
+	var movingTime time.Duration
+	var stops []Stop
+	var err error
+
+	if options.MaxSpeed <= 0 {
+		options.MaxSpeed = conDefaultStopSpeed
+	}
+	if options.MinDuration <= 0 {
+		options.MinDuration = conDefaultStopDuration
+	}
+
+	// We have to loop over the track segments
+	for _, segment := range track.Segments {
+		var points []TrackPoint
+		var times []time.Time
+		for _, point := range segment.Points {
+			if point.Time == "" {
+				continue
+			}
+			pointTime, err := time.Parse(time.RFC3339, point.Time)
+			if err != nil {
+				return 0, stops, err
+			}
+			points = append(points, point)
+			times = append(times, pointTime)
+		}
+
+		// Loop over the legs between the points. Slow legs following each other are
+		// collected, if they take long enough they are a stop.
+		var slowStart = -1
+		var finishSlow = func(end int) {
+			if slowStart < 0 {
+				return
+			}
+			var duration = times[end].Sub(times[slowStart])
+			if duration >= options.MinDuration {
+				stops = append(stops, Stop{points[slowStart].Latitude, points[slowStart].Longitude, times[slowStart], times[end]})
+			} else {
+				movingTime = movingTime + duration
+			}
+			slowStart = -1
+		}
+		for i := 1; i < len(points); i++ {
+			var duration = times[i].Sub(times[i-1])
+			if duration <= 0 {
+				continue
+			}
+			var distance = pointDistance(points[i-1].Latitude, points[i-1].Longitude, 0, points[i].Latitude, points[i].Longitude, 0, DistanceOptions{Method: DistanceGeodesic})
+			var speed = distance / duration.Seconds() * 3.6
+
+			if speed < options.MaxSpeed {
+				if slowStart < 0 {
+					slowStart = i - 1
+				}
+			} else {
+				finishSlow(i - 1)
+				movingTime = movingTime + duration
+			}
+		}
+		if len(points) > 0 {
+			finishSlow(len(points) - 1)
+		}
+	}
+
+	return int64(movingTime.Round(time.Second).Seconds()), stops, err
+}
@@ -4,36 +4,98 @@ import "encoding/xml"
 
 // GPX is the main structure for GPX files
 type GPX struct {
-	XMLName  xml.Name `xml:"gpx"`
-	Metadata Metadata `xml:"metadata"`
-	Routes   []Route  `xml:"rte"`
-	Tracks   []Track  `xml:"trk"`
+	XMLName   xml.Name   `xml:"gpx"`
+	Language  string     `xml:"lang,attr"`
+	Metadata  Metadata   `xml:"metadata"`
+	Waypoints []Waypoint `xml:"wpt"`
+	Routes    []Route    `xml:"rte"`
+	Tracks    []Track    `xml:"trk"`
 }
 
 // Metadata contains some metadata from the GPX file
 type Metadata struct {
-	XMLName     xml.Name `xml:"metadata"`
-	Name        string   `xml:"name"`
-	Time        string   `xml:"time"`
-	Description string   `xml:"desc"`
+	XMLName     xml.Name       `xml:"metadata"`
+	Language    string         `xml:"lang,attr"`
+	Name        string         `xml:"name"`
+	Time        string         `xml:"time"`
+	Description string         `xml:"desc"`
+	Extensions  TextExtensions `xml:"extensions"`
 }
 
 // Route contains details for a GPX route
 type Route struct {
 	XMLName        xml.Name        `xml:"rte"`
+	Language       string          `xml:"lang,attr"`
 	Name           string          `xml:"name"`
 	Description    string          `xml:"desc"`
+	Extensions     TextExtensions  `xml:"extensions"`
 	RouteWaypoints []RouteWaypoint `xml:"rtept"`
 }
 
-// RouteWaypoint contains details for a GPX route waypoint
+// TextExtensions contains translations of names and descriptions, provided
+// as GPX extensions, e.g. <extensions><name xml:lang="de">...</name></extensions>
+type TextExtensions struct {
+	Names        []LocalizedText `xml:"name"`
+	Descriptions []LocalizedText `xml:"desc"`
+}
+
+// LocalizedText is a text together with the language it is written in
+type LocalizedText struct {
+	Language string `xml:"lang,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// RouteWaypoint contains details for a GPX route waypoint. Always marks waypoints
+// the navigation system has to stop at, in addition to the first and the last one.
 type RouteWaypoint struct {
-	XMLName     xml.Name `xml:"rtept"`
-	Latitude    float64  `xml:"lat,attr"`
-	Longitude   float64  `xml:"lon,attr"`
-	Name        string   `xml:"name"`
-	Description string   `xml:"desc"`
-	Elevation   float64  `xml:"ele"`
+	XMLName     xml.Name           `xml:"rtept"`
+	Latitude    float64            `xml:"lat,attr"`
+	Longitude   float64            `xml:"lon,attr"`
+	Name        string             `xml:"name"`
+	Description string             `xml:"desc"`
+	Elevation   float64            `xml:"ele"`
+	Extensions  WaypointExtensions `xml:"extensions"`
+	Address     Address            `xml:"-"`
+	Always      bool               `xml:"-"`
+
+	// HasElevation tells if the elevation has been read from the GPX file or filled
+	// in, because 0 is a valid elevation as well
+	HasElevation bool `xml:"-"`
+}
+
+// Waypoint contains details for a GPX waypoint. Route planners like Garmin BaseCamp
+// store the address of a route point in the waypoint at the same position.
+type Waypoint struct {
+	XMLName    xml.Name           `xml:"wpt"`
+	Latitude   float64            `xml:"lat,attr"`
+	Longitude  float64            `xml:"lon,attr"`
+	Name       string             `xml:"name"`
+	Extensions WaypointExtensions `xml:"extensions"`
+}
+
+// WaypointExtensions contains the extensions of a waypoint we are interested in
+type WaypointExtensions struct {
+	GarminAddress GarminAddress `xml:"WaypointExtension>Address"`
+}
+
+// GarminAddress contains an address as written by Garmin devices and BaseCamp
+// in the GPX extension namespace http://www.garmin.com/xmlschemas/GpxExtensions/v3
+type GarminAddress struct {
+	StreetAddress []string `xml:"StreetAddress"`
+	City          string   `xml:"City"`
+	State         string   `xml:"State"`
+	Country       string   `xml:"Country"`
+	PostalCode    string   `xml:"PostalCode"`
+}
+
+// Address contains the postal address of a waypoint
+type Address struct {
+	Country     string
+	State       string
+	City        string
+	PostalCode  string
+	Street      string
+	HouseNumber string
 }
 
 // Track contains details for a GPX track
@@ -56,4 +118,8 @@ type TrackPoint struct {
 	Longitude float64  `xml:"lon,attr"`
 	Elevation float64  `xml:"ele"`
 	Time      string   `xml:"time"`
+
+	// HasElevation tells if the elevation has been read from the GPX file or filled
+	// in, because 0 is a valid elevation as well
+	HasElevation bool `xml:"-"`
 }
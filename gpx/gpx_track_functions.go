@@ -5,6 +5,9 @@ import (
 	"time"
 )
 
+// constant for earths medium radius in meters, source: wikipedia
+const conEarthRadiusInMeters float64 = 6371000.785
+
 // meterCoordinates can contain 3 dimensional coordinates in meters
 type meterCoordinates struct {
 	x float64
@@ -21,6 +24,11 @@ func (track Track) CalcTotalDuration() (int64, error) {
 	// We have to loop over the track segments
 	for _, segment := range track.Segments {
 
+		// Empty segments do not take any time
+		if len(segment.Points) == 0 {
+			continue
+		}
+
 		// The time information can be missing - in this case, we cannot calculate the
 		// duration for this track.
 		if segment.Points[0].Time == "" || segment.Points[len(segment.Points)-1].Time == "" {
@@ -48,41 +56,19 @@ func (track Track) CalcTotalDuration() (int64, error) {
 }
 
 // CalcTotalDistance calculates the distance of a GPX track in meters, also considering the elevation provided in the GPX file.
+// Straight lines on a sphere are used, see CalcDistance for other methods.
 func (track Track) CalcTotalDistance() float64 {
-	var totalDistance float64
-	var distance float64
-
-	// We have to loop over the track segments
-	for _, segment := range track.Segments {
-
-		// Loop over the track points to calculate the distance
-		// We skip the first entry so that we will not run out of bounds at the end of the array
-		for i := 1; i < len(segment.Points); i++ {
-
-			// calculate the meter based coordinates
-			var coord = coordinatesToMeters(segment.Points[i].Elevation, segment.Points[i].Latitude, segment.Points[i].Longitude)
-			var coordBefore = coordinatesToMeters(segment.Points[i-1].Elevation, segment.Points[i-1].Latitude, segment.Points[i-1].Longitude)
-
-			// calculate the distance between these two points and add it to total distance of the track
-			distance = math.Sqrt(math.Pow(coord.x-coordBefore.x, 2) + math.Pow(coord.y-coordBefore.y, 2) + math.Pow(coord.z-coordBefore.z, 2))
-			totalDistance = totalDistance + distance
-		}
-	}
-
-	return totalDistance
+	return track.CalcDistance(DistanceOptions{})
 }
 
 // coordinatesToMeters converts the coordinates to meter-like coordinates, so that we can calculate the distance easier
 func coordinatesToMeters(elevation float64, latitude float64, longitude float64) meterCoordinates {
-	// constant for earths medium radius in meters, source: wikipedia
-	const earthRadiusInMeters float64 = 6371000.785
-
 	// return variable
 	var coordinates meterCoordinates
 
 	// Thanks to Ignacio Vazquez-Abrams for his answer of this stackoverflow question:
 	// https://stackoverflow.com/questions/29827636/distance-between-two-points-including-elevation
-	var r = earthRadiusInMeters + elevation
+	var r = conEarthRadiusInMeters + elevation
 	var theta = latitude * math.Pi / 180
 	var phi = longitude * math.Pi / 180
 
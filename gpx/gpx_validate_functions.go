@@ -0,0 +1,210 @@
+package gpx
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Problems of coordinates, see CoordinateError
+var (
+	ErrOutOfRange = errors.New("coordinate out of range")
+	ErrSwapped    = errors.New("latitude and longitude probably swapped")
+	ErrNullIsland = errors.New("coordinate at 0, 0 (null island), probably missing")
+)
+
+// Distances in meters to detect swapped coordinates: the point is farther away from
+// the other points than conSwapDistance, but closer than conSwapDistance / 10 once
+// latitude and longitude are swapped
+const conSwapDistance float64 = 1000000
+
+// Minimum number of other points needed to detect swapped coordinates
+const conSwapMinPoints int = 3
+
+// CoordinateError describes an invalid coordinate of a GPX element
+type CoordinateError struct {
+	// Element is the path of the GPX element, e.g. "rte[1]/rtept[3]"
+	Element string
+
+	// Latitude and Longitude as read from the GPX file
+	Latitude  float64
+	Longitude float64
+
+	// Problem is ErrOutOfRange, ErrSwapped or ErrNullIsland
+	Problem error
+
+	// Fixed tells if the element has been changed or removed
+	Fixed bool
+}
+
+// ValidationError is returned if the GPX file contains invalid coordinates which
+// have not been fixed
+type ValidationError struct {
+	Errors []CoordinateError
+}
+
+// Error returns the element, its coordinates and the problem
+func (coordinateError CoordinateError) Error() string {
+	var text = coordinateError.Element + " (" + strconv.FormatFloat(coordinateError.Latitude, 'f', -1, 64) + ", " + strconv.FormatFloat(coordinateError.Longitude, 'f', -1, 64) + "): " + coordinateError.Problem.Error()
+	if coordinateError.Fixed {
+		text = text + " (fixed)"
+	}
+	return text
+}
+
+// Unwrap returns the problem, so that errors.Is works
+func (coordinateError CoordinateError) Unwrap() error {
+	return coordinateError.Problem
+}
+
+// Error lists all invalid coordinates, one per line
+func (validationError *ValidationError) Error() string {
+	var lines = []string{"the GPX file contains " + strconv.Itoa(len(validationError.Errors)) + " invalid coordinates:"}
+	for _, coordinateError := range validationError.Errors {
+		lines = append(lines, coordinateError.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the invalid coordinates, so that errors.Is and errors.As work
+func (validationError *ValidationError) Unwrap() []error {
+	var errs []error
+	for _, coordinateError := range validationError.Errors {
+		errs = append(errs, coordinateError)
+	}
+	return errs
+}
+
+// ValidateCoordinates checks the coordinates of all route waypoints and track
+// points: they have to be within range, must not be 0, 0 and should not have
+// latitude and longitude swapped. If fix is true, swapped coordinates are swapped
+// back, longitudes beyond 180 degrees are wrapped and invalid track points are
+// removed. Returns all problems found and a ValidationError for those which have
+// not been fixed.
+func (gpx *GPX) ValidateCoordinates(fix bool) ([]CoordinateError, error) {
+	var problems []CoordinateError
+	var unfixed []CoordinateError
+	var err error
+
+	var sum, count = gpx.coordinateSum()
+
+	// check returns the problem of a coordinate, and fixes it if possible
+	var check = func(element string, latitude *float64, longitude *float64, removable bool) bool {
+		var problem = CoordinateError{Element: element, Latitude: *latitude, Longitude: *longitude}
+		var keep = true
+
+		switch {
+		case math.IsNaN(*latitude) || math.IsNaN(*longitude) || math.IsInf(*latitude, 0) || math.IsInf(*longitude, 0):
+			problem.Problem = ErrOutOfRange
+			problem.Fixed = fix && removable
+			keep = !problem.Fixed
+		case math.Abs(*latitude) > 90 && math.Abs(*longitude) <= 90 && (count <= conSwapMinPoints || sum.angle(toVector(*longitude, *latitude))*conEarthRadiusInMeters < conSwapDistance):
+			problem.Problem = ErrSwapped
+			problem.Fixed = fix
+			if fix {
+				*latitude, *longitude = *longitude, *latitude
+			}
+		case math.Abs(*latitude) > 90:
+			problem.Problem = ErrOutOfRange
+			problem.Fixed = fix && removable
+			keep = !problem.Fixed
+		case math.Abs(*longitude) > 180:
+			problem.Problem = ErrOutOfRange
+			problem.Fixed = fix && math.Abs(*longitude) < 540
+			if problem.Fixed {
+				*longitude = normalizeLongitude(*longitude)
+			}
+		case math.Abs(*latitude) < 1e-7 && math.Abs(*longitude) < 1e-7:
+			problem.Problem = ErrNullIsland
+			problem.Fixed = fix && removable
+			keep = !problem.Fixed
+		case count > conSwapMinPoints && isSwapped(*latitude, *longitude, sum):
+			problem.Problem = ErrSwapped
+			problem.Fixed = fix
+			if fix {
+				*latitude, *longitude = *longitude, *latitude
+			}
+		default:
+			return true
+		}
+
+		problems = append(problems, problem)
+		if !problem.Fixed {
+			unfixed = append(unfixed, problem)
+		}
+		return keep
+	}
+
+	// Loop over the route waypoints, which cannot be removed
+	for i := range gpx.Routes {
+		for j := range gpx.Routes[i].RouteWaypoints {
+			var waypoint = &gpx.Routes[i].RouteWaypoints[j]
+			check("rte["+strconv.Itoa(i+1)+"]/rtept["+strconv.Itoa(j+1)+"]", &waypoint.Latitude, &waypoint.Longitude, false)
+		}
+	}
+
+	// Loop over the track points
+	for i := range gpx.Tracks {
+		for j := range gpx.Tracks[i].Segments {
+			var segment = &gpx.Tracks[i].Segments[j]
+			var points []TrackPoint
+			for k, point := range segment.Points {
+				if check("trk["+strconv.Itoa(i+1)+"]/trkseg["+strconv.Itoa(j+1)+"]/trkpt["+strconv.Itoa(k+1)+"]", &point.Latitude, &point.Longitude, true) {
+					points = append(points, point)
+				}
+			}
+			segment.Points = points
+		}
+	}
+
+	if len(unfixed) > 0 {
+		err = &ValidationError{Errors: unfixed}
+	}
+	return problems, err
+}
+
+// coordinateSum returns the sum of all valid coordinates as points on the unit
+// sphere and their number
+func (gpx GPX) coordinateSum() (vector, int) {
+	var sum vector
+	var count int
+	var add = func(latitude float64, longitude float64) {
+		if math.Abs(latitude) > 90 || math.Abs(longitude) > 180 || math.IsNaN(latitude) || math.IsNaN(longitude) || (latitude == 0 && longitude == 0) {
+			return
+		}
+		var v = toVector(latitude, longitude)
+		sum = vector{sum.x + v.x, sum.y + v.y, sum.z + v.z}
+		count++
+	}
+	for _, route := range gpx.Routes {
+		for _, waypoint := range route.RouteWaypoints {
+			add(waypoint.Latitude, waypoint.Longitude)
+		}
+	}
+	for _, track := range gpx.Tracks {
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				add(point.Latitude, point.Longitude)
+			}
+		}
+	}
+	return sum, count
+}
+
+// isSwapped tells if a coordinate is far away from the center of all other
+// coordinates, but close to it once latitude and longitude are swapped. The sum
+// of all coordinates includes the coordinate itself.
+func isSwapped(latitude float64, longitude float64, sum vector) bool {
+	if math.Abs(longitude) > 90 {
+		return false
+	}
+	var own = toVector(latitude, longitude)
+	var center = vector{sum.x - own.x, sum.y - own.y, sum.z - own.z}
+	if center.length() < 1e-9 {
+		return false
+	}
+	var distance = center.angle(toVector(latitude, longitude)) * conEarthRadiusInMeters
+	var swappedDistance = center.angle(toVector(longitude, latitude)) * conEarthRadiusInMeters
+	return distance > conSwapDistance && swappedDistance < conSwapDistance/10
+}
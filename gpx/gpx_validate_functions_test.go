@@ -0,0 +1,83 @@
+package gpx
+
+import (
+	"errors"
+	"testing"
+)
+
+// testTrack returns a track with the given coordinates as latitude, longitude pairs
+func testTrack(coordinates ...[2]float64) Track {
+	var segment TrackSegment
+	for _, coordinate := range coordinates {
+		segment.Points = append(segment.Points, TrackPoint{Latitude: coordinate[0], Longitude: coordinate[1]})
+	}
+	return Track{Segments: []TrackSegment{segment}}
+}
+
+func TestValidateCoordinates(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		track    Track
+		problems []error
+		expected [][2]float64
+	}{
+		{"valid", testTrack([2]float64{48, 11}, [2]float64{48.1, 11.1}), nil, [][2]float64{{48, 11}, {48.1, 11.1}}},
+		{"null island", testTrack([2]float64{48, 11}, [2]float64{0, 0}, [2]float64{48.1, 11.1}), []error{ErrNullIsland}, [][2]float64{{48, 11}, {48.1, 11.1}}},
+		{"swapped", testTrack([2]float64{48, 11}, [2]float64{48.1, 11.1}, [2]float64{48.2, 11.2}, [2]float64{48.3, 11.3}, [2]float64{11.15, 48.15}),
+			[]error{ErrSwapped}, [][2]float64{{48, 11}, {48.1, 11.1}, {48.2, 11.2}, {48.3, 11.3}, {48.15, 11.15}}},
+		// Latitude out of range, fits once swapped
+		{"swapped at the antimeridian", testTrack([2]float64{10, 179.9}, [2]float64{10.1, -179.9}, [2]float64{179.95, 10.05}),
+			[]error{ErrSwapped}, [][2]float64{{10, 179.9}, {10.1, -179.9}, {10.05, 179.95}}},
+		{"longitude beyond 180", testTrack([2]float64{10, 179.9}, [2]float64{10.1, 180.1}), []error{ErrOutOfRange}, [][2]float64{{10, 179.9}, {10.1, -179.9}}},
+		{"latitude out of range", testTrack([2]float64{89.9, 11}, [2]float64{90.1, 100}), []error{ErrOutOfRange}, [][2]float64{{89.9, 11}}},
+		// Points around the pole are far apart in longitude, but not swapped
+		{"pole", testTrack([2]float64{89.9, 0}, [2]float64{89.9, 60}, [2]float64{89.9, 120}, [2]float64{89.9, -120}, [2]float64{89.9, -60}), nil,
+			[][2]float64{{89.9, 0}, {89.9, 60}, {89.9, 120}, {89.9, -120}, {89.9, -60}}},
+	} {
+		var gpxFile = GPX{Tracks: []Track{test.track}}
+		problems, err := gpxFile.ValidateCoordinates(true)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if len(problems) != len(test.problems) {
+			t.Errorf("%s: problems %v, expected %v", test.name, problems, test.problems)
+			continue
+		}
+		for i, problem := range problems {
+			if !errors.Is(problem, test.problems[i]) || !problem.Fixed {
+				t.Errorf("%s: problem %v, expected %v", test.name, problem, test.problems[i])
+			}
+		}
+
+		var points = gpxFile.Tracks[0].Segments[0].Points
+		if len(points) != len(test.expected) {
+			t.Errorf("%s: points %v, expected %v", test.name, points, test.expected)
+			continue
+		}
+		for i, point := range points {
+			if point.Latitude != test.expected[i][0] || point.Longitude-test.expected[i][1] > 1e-9 || test.expected[i][1]-point.Longitude > 1e-9 {
+				t.Errorf("%s: point %d at %v, %v, expected %v", test.name, i+1, point.Latitude, point.Longitude, test.expected[i])
+			}
+		}
+	}
+}
+
+func TestValidateCoordinatesStrict(t *testing.T) {
+	// Route waypoints are never removed, so null island stays an error
+	var gpxFile = GPX{Routes: []Route{{RouteWaypoints: []RouteWaypoint{{Latitude: 48, Longitude: 11}, {}}}}}
+	problems, err := gpxFile.ValidateCoordinates(true)
+
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) || len(validationError.Errors) != 1 || validationError.Errors[0].Element != "rte[1]/rtept[2]" {
+		t.Fatalf("error %v, expected null island at rte[1]/rtept[2]", err)
+	}
+	if len(problems) != 1 || problems[0].Fixed || !errors.Is(err, ErrNullIsland) {
+		t.Errorf("problems %v, error %v", problems, err)
+	}
+
+	// Without fixing, nothing is changed
+	gpxFile = GPX{Tracks: []Track{testTrack([2]float64{10, 179.9}, [2]float64{10.1, 180.1})}}
+	if _, err = gpxFile.ValidateCoordinates(false); !errors.Is(err, ErrOutOfRange) || gpxFile.Tracks[0].Segments[0].Points[1].Longitude != 180.1 {
+		t.Errorf("error %v, points %v", err, gpxFile.Tracks[0].Segments[0].Points)
+	}
+}
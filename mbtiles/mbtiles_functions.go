@@ -0,0 +1,128 @@
+package mbtiles
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/jpeg" // needed to decode JPEG tiles
+	_ "image/png"  // needed to decode PNG tiles
+	"strconv"
+)
+
+// Zoom levels assumed if the metadata of the file does not contain them
+const conDefaultMinZoom int = 0
+const conDefaultMaxZoom int = 22
+
+// Open opens a MBTiles file for reading. Only raster tiles in PNG or JPEG format are
+// supported. Both the plain layout with a table "tiles" and the deduplicated layout
+// with the tables "map" and "images" can be read.
+func Open(mbtilesPath string) (*MBTiles, error) {
+	var tiles MBTiles
+	var err error
+
+	tiles.db, err = openDatabase(mbtilesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Layout of the file
+	table, ok := tiles.db.table("tiles")
+	if !ok {
+		tiles.db.close()
+		return nil, errors.New("no tiles found in " + mbtilesPath)
+	}
+	if table.entryType == "view" {
+		_, hasMap := tiles.db.table("map")
+		_, hasImages := tiles.db.table("images")
+		if !hasMap || !hasImages {
+			tiles.db.close()
+			return nil, errors.New("unsupported layout of " + mbtilesPath)
+		}
+		tiles.deduplicated = true
+	}
+
+	// Metadata
+	var metadata = make(map[string]string)
+	if metadataTable, ok := tiles.db.table("metadata"); ok && metadataTable.entryType == "table" {
+		err = tiles.db.scanTable(metadataTable.rootPage, func(rowID int64, record []interface{}) error {
+			if len(record) >= 2 {
+				name, _ := record[0].(string)
+				value, _ := record[1].(string)
+				metadata[name] = value
+			}
+			return nil
+		})
+		if err != nil {
+			tiles.db.close()
+			return nil, err
+		}
+	}
+
+	switch metadata["format"] {
+	case "", "png", "jpg", "jpeg":
+	default:
+		tiles.db.close()
+		return nil, errors.New("unsupported tile format \"" + metadata["format"] + "\" in " + mbtilesPath + ", only PNG and JPEG tiles are supported")
+	}
+
+	tiles.minZoom = conDefaultMinZoom
+	tiles.maxZoom = conDefaultMaxZoom
+	if zoom, err := strconv.Atoi(metadata["minzoom"]); err == nil {
+		tiles.minZoom = zoom
+	}
+	if zoom, err := strconv.Atoi(metadata["maxzoom"]); err == nil {
+		tiles.maxZoom = zoom
+	}
+	tiles.attribution = metadata["attribution"]
+
+	return &tiles, nil
+}
+
+// Close closes the MBTiles file
+func (tiles *MBTiles) Close() error {
+	return tiles.db.close()
+}
+
+// ZoomRange returns the lowest and the highest zoom level contained in the file
+func (tiles *MBTiles) ZoomRange() (int, int) {
+	return tiles.minZoom, tiles.maxZoom
+}
+
+// Attribution returns the attribution stored in the metadata of the file
+func (tiles *MBTiles) Attribution() string {
+	return tiles.attribution
+}
+
+// Tile returns the tile with the given coordinates, using the XYZ scheme with the
+// origin in the north west. If the file does not contain this tile, nil is returned.
+func (tiles *MBTiles) Tile(zoom int, x int, y int) (image.Image, error) {
+	// MBTiles uses the TMS scheme with the origin in the south west
+	var row = (1 << uint(zoom)) - 1 - y
+	var key = []interface{}{int64(zoom), int64(x), int64(row)}
+	var keyColumns = []string{"zoom_level", "tile_column", "tile_row"}
+
+	var data []byte
+	if tiles.deduplicated {
+		rows, err := tiles.db.lookup("map", keyColumns, key)
+		if err != nil || len(rows) == 0 {
+			return nil, err
+		}
+		images, err := tiles.db.lookup("images", []string{"tile_id"}, []interface{}{rows[0]["tile_id"]})
+		if err != nil || len(images) == 0 {
+			return nil, err
+		}
+		data, _ = images[0]["tile_data"].([]byte)
+	} else {
+		rows, err := tiles.db.lookup("tiles", keyColumns, key)
+		if err != nil || len(rows) == 0 {
+			return nil, err
+		}
+		data, _ = rows[0]["tile_data"].([]byte)
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
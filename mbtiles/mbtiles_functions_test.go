@@ -0,0 +1,91 @@
+package mbtiles
+
+import (
+	"image/color"
+	"testing"
+)
+
+// The fixture is built from testdata/tiles.sql, see there
+const conTestFile string = "testdata/tiles.mbtiles"
+
+func TestOpenMetadata(t *testing.T) {
+	tiles, err := Open(conTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tiles.Close()
+
+	minZoom, maxZoom := tiles.ZoomRange()
+	if minZoom != 3 || maxZoom != 3 {
+		t.Errorf("zoom range is %d-%d, expected 3-3", minZoom, maxZoom)
+	}
+	if tiles.Attribution() != "Test attribution" {
+		t.Errorf("attribution is %q", tiles.Attribution())
+	}
+}
+
+func TestFixturePages(t *testing.T) {
+	tiles, err := Open(conTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tiles.Close()
+
+	// Without interior pages, the test would not cover the tree search
+	var found = make(map[string]bool)
+	for _, entry := range tiles.db.schema {
+		if entry.name != "tiles" && entry.name != "tile_index" {
+			continue
+		}
+		found[entry.name] = true
+		page, headerOffset, err := tiles.db.readPage(entry.rootPage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page[headerOffset] != conPageInteriorTable && page[headerOffset] != conPageInteriorIndex {
+			t.Errorf("root page of %s is no interior page", entry.name)
+		}
+	}
+	if !found["tiles"] || !found["tile_index"] {
+		t.Errorf("tiles or tile_index not found in the schema")
+	}
+}
+
+func TestTile(t *testing.T) {
+	tiles, err := Open(conTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tiles.Close()
+
+	// Every tile is a single pixel whose color encodes its position. The tile in the
+	// north west corner is padded so that it needs overflow pages.
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			img, err := tiles.Tile(3, x, y)
+			if err != nil {
+				t.Fatalf("tile 3/%d/%d: %v", x, y, err)
+			}
+			if img == nil {
+				t.Fatalf("tile 3/%d/%d not found", x, y)
+			}
+			var expected = color.RGBA{uint8(x * 30), uint8((7 - y) * 30), 0, 255}
+			if got := color.RGBAModel.Convert(img.At(0, 0)); got != expected {
+				t.Errorf("tile 3/%d/%d has color %v, expected %v", x, y, got, expected)
+			}
+		}
+	}
+}
+
+func TestMissingTile(t *testing.T) {
+	tiles, err := Open(conTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tiles.Close()
+
+	img, err := tiles.Tile(4, 0, 0)
+	if err != nil || img != nil {
+		t.Errorf("missing tile returned %v, %v", img, err)
+	}
+}
@@ -0,0 +1,570 @@
+package mbtiles
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// B-tree page types of SQLite database files
+const conPageInteriorIndex byte = 0x02
+const conPageInteriorTable byte = 0x05
+const conPageLeafIndex byte = 0x0a
+const conPageLeafTable byte = 0x0d
+
+// openDatabase opens a SQLite database file for reading and reads its schema
+func openDatabase(databasePath string) (*database, error) {
+	var db database
+	var err error
+
+	db.file, err = os.Open(databasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The header is the first 100 bytes of the file
+	var header = make([]byte, 100)
+	if _, err = io.ReadFull(db.file, header); err != nil {
+		db.file.Close()
+		return nil, errors.New("not a SQLite database: " + databasePath)
+	}
+	if string(header[:16]) != "SQLite format 3\x00" {
+		db.file.Close()
+		return nil, errors.New("not a SQLite database: " + databasePath)
+	}
+	db.pageSize = int(binary.BigEndian.Uint16(header[16:18]))
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+	db.usableSize = db.pageSize - int(header[20])
+	if binary.BigEndian.Uint32(header[56:60]) > 1 {
+		db.file.Close()
+		return nil, errors.New("only UTF-8 encoded SQLite databases are supported")
+	}
+
+	// The schema is stored in the table sqlite_master with root page 1
+	err = db.scanTable(1, func(rowID int64, values []interface{}) error {
+		if len(values) < 5 {
+			return nil
+		}
+		var entry schemaEntry
+		entry.entryType, _ = values[0].(string)
+		entry.name, _ = values[1].(string)
+		entry.tableName, _ = values[2].(string)
+		rootPage, _ := values[3].(int64)
+		entry.rootPage = int(rootPage)
+		entry.sql, _ = values[4].(string)
+		db.schema = append(db.schema, entry)
+		return nil
+	})
+	if err != nil {
+		db.file.Close()
+		return nil, err
+	}
+
+	return &db, nil
+}
+
+// close closes the database file
+func (db *database) close() error {
+	return db.file.Close()
+}
+
+// table returns the schema entry of a table or view
+func (db *database) table(name string) (schemaEntry, bool) {
+	for _, entry := range db.schema {
+		if (entry.entryType == "table" || entry.entryType == "view") && strings.EqualFold(entry.name, name) {
+			return entry, true
+		}
+	}
+	return schemaEntry{}, false
+}
+
+// lookup returns all rows of a table where the columns have the given values. If
+// there is an index starting with these columns, it is used, otherwise the whole
+// table is scanned. The rows are returned as maps from column name to value.
+func (db *database) lookup(tableName string, columns []string, values []interface{}) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+
+	table, ok := db.table(tableName)
+	if !ok || table.entryType != "table" {
+		return rows, errors.New("table " + tableName + " not found")
+	}
+	var tableColumns, rowIDColumn = parseColumns(table.sql)
+
+	var toRow = func(rowID int64, record []interface{}) map[string]interface{} {
+		var row = make(map[string]interface{})
+		for i, column := range tableColumns {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		if rowIDColumn != "" {
+			row[rowIDColumn] = rowID
+		}
+		return row
+	}
+
+	// Use an index if possible
+	for _, entry := range db.schema {
+		if entry.entryType != "index" || !strings.EqualFold(entry.tableName, tableName) || entry.rootPage == 0 {
+			continue
+		}
+		var indexColumns = parseIndexColumns(entry.sql)
+		if len(indexColumns) < len(columns) || !equalFoldAll(indexColumns[:len(columns)], columns) {
+			continue
+		}
+
+		rowIDs, err := db.searchIndex(entry.rootPage, values)
+		if err != nil {
+			return rows, err
+		}
+		for _, rowID := range rowIDs {
+			record, found, err := db.findRow(table.rootPage, rowID)
+			if err != nil {
+				return rows, err
+			}
+			if found {
+				rows = append(rows, toRow(rowID, record))
+			}
+		}
+		return rows, nil
+	}
+
+	// Scan the whole table
+	err := db.scanTable(table.rootPage, func(rowID int64, record []interface{}) error {
+		var row = toRow(rowID, record)
+		for i, column := range columns {
+			if compareValues(row[column], values[i]) != 0 {
+				return nil
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+// scanTable calls fn for every row of a table b-tree
+func (db *database) scanTable(pageNumber int, fn func(rowID int64, record []interface{}) error) error {
+	page, headerOffset, err := db.readPage(pageNumber)
+	if err != nil {
+		return err
+	}
+
+	var cells = cellOffsets(page, headerOffset)
+	switch page[headerOffset] {
+	case conPageInteriorTable:
+		for _, offset := range cells {
+			if err = db.scanTable(int(binary.BigEndian.Uint32(page[offset:])), fn); err != nil {
+				return err
+			}
+		}
+		return db.scanTable(int(binary.BigEndian.Uint32(page[headerOffset+8:])), fn)
+	case conPageLeafTable:
+		for _, offset := range cells {
+			rowID, record, err := db.readTableCell(page, offset)
+			if err != nil {
+				return err
+			}
+			if err = fn(rowID, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("invalid table page in SQLite database")
+}
+
+// findRow looks up a single row of a table b-tree by its row ID
+func (db *database) findRow(pageNumber int, rowID int64) ([]interface{}, bool, error) {
+	for {
+		page, headerOffset, err := db.readPage(pageNumber)
+		if err != nil {
+			return nil, false, err
+		}
+
+		var cells = cellOffsets(page, headerOffset)
+		switch page[headerOffset] {
+		case conPageInteriorTable:
+			// Rows with a row ID up to the key of a cell are in its left child
+			pageNumber = int(binary.BigEndian.Uint32(page[headerOffset+8:]))
+			for _, offset := range cells {
+				key, _ := readVarint(page[offset+4:])
+				if rowID <= int64(key) {
+					pageNumber = int(binary.BigEndian.Uint32(page[offset:]))
+					break
+				}
+			}
+		case conPageLeafTable:
+			for _, offset := range cells {
+				cellRowID, record, err := db.readTableCell(page, offset)
+				if err != nil {
+					return nil, false, err
+				}
+				if cellRowID == rowID {
+					return record, true, nil
+				}
+			}
+			return nil, false, nil
+		default:
+			return nil, false, errors.New("invalid table page in SQLite database")
+		}
+	}
+}
+
+// searchIndex returns the row IDs of all index entries starting with the given values
+func (db *database) searchIndex(pageNumber int, values []interface{}) ([]int64, error) {
+	var rowIDs []int64
+
+	page, headerOffset, err := db.readPage(pageNumber)
+	if err != nil {
+		return rowIDs, err
+	}
+
+	var interior = page[headerOffset] == conPageInteriorIndex
+	if !interior && page[headerOffset] != conPageLeafIndex {
+		return rowIDs, errors.New("invalid index page in SQLite database")
+	}
+
+	for _, offset := range cellOffsets(page, headerOffset) {
+		var payloadOffset = offset
+		if interior {
+			payloadOffset = offset + 4
+		}
+		record, err := db.readIndexCell(page, payloadOffset)
+		if err != nil {
+			return rowIDs, err
+		}
+
+		// Compare the beginning of the entry with the values we are looking for
+		var comparison = 0
+		for i := 0; i < len(values) && i < len(record) && comparison == 0; i++ {
+			comparison = compareValues(record[i], values[i])
+		}
+
+		// Entries before this one are in the left child
+		if interior && comparison >= 0 {
+			childIDs, err := db.searchIndex(int(binary.BigEndian.Uint32(page[offset:])), values)
+			if err != nil {
+				return rowIDs, err
+			}
+			rowIDs = append(rowIDs, childIDs...)
+		}
+		if comparison == 0 && len(record) > 0 {
+			if rowID, ok := record[len(record)-1].(int64); ok {
+				rowIDs = append(rowIDs, rowID)
+			}
+		}
+		if comparison > 0 {
+			return rowIDs, nil
+		}
+	}
+
+	// Entries after the last cell are in the right-most child
+	if interior {
+		childIDs, err := db.searchIndex(int(binary.BigEndian.Uint32(page[headerOffset+8:])), values)
+		if err != nil {
+			return rowIDs, err
+		}
+		rowIDs = append(rowIDs, childIDs...)
+	}
+	return rowIDs, nil
+}
+
+// readPage reads a page of the database. The second return value is the offset of
+// the b-tree page header, which is 100 on the first page because of the file header.
+func (db *database) readPage(pageNumber int) ([]byte, int, error) {
+	if pageNumber < 1 {
+		return nil, 0, errors.New("invalid page number in SQLite database")
+	}
+	var page = make([]byte, db.pageSize)
+	if _, err := db.file.ReadAt(page, int64(pageNumber-1)*int64(db.pageSize)); err != nil {
+		return nil, 0, err
+	}
+	if pageNumber == 1 {
+		return page, 100, nil
+	}
+	return page, 0, nil
+}
+
+// readTableCell reads the row ID and the record of a table leaf cell
+func (db *database) readTableCell(page []byte, offset int) (int64, []interface{}, error) {
+	payloadSize, n := readVarint(page[offset:])
+	rowID, m := readVarint(page[offset+n:])
+	record, err := db.readRecord(page, offset+n+m, int(payloadSize), db.usableSize-35)
+	return int64(rowID), record, err
+}
+
+// readIndexCell reads the record of an index cell, which ends with the row ID
+func (db *database) readIndexCell(page []byte, offset int) ([]interface{}, error) {
+	payloadSize, n := readVarint(page[offset:])
+	return db.readRecord(page, offset+n, int(payloadSize), (db.usableSize-12)*64/255-23)
+}
+
+// readRecord reads a payload of the given size starting at offset, following the
+// overflow pages if needed, and decodes the record contained in it
+func (db *database) readRecord(page []byte, offset int, size int, maxLocal int) ([]interface{}, error) {
+	// Size of the part stored on this page, see the SQLite file format documentation
+	var local = size
+	if size > maxLocal {
+		var minLocal = (db.usableSize-12)*32/255 - 23
+		local = minLocal + (size-minLocal)%(db.usableSize-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if offset+local > len(page) {
+		return nil, errors.New("invalid cell in SQLite database")
+	}
+
+	var payload = make([]byte, 0, size)
+	payload = append(payload, page[offset:offset+local]...)
+
+	// Overflow pages
+	if local < size {
+		var overflowPage = int(binary.BigEndian.Uint32(page[offset+local:]))
+		for len(payload) < size && overflowPage != 0 {
+			overflow, _, err := db.readPage(overflowPage)
+			if err != nil {
+				return nil, err
+			}
+			var chunk = size - len(payload)
+			if chunk > db.usableSize-4 {
+				chunk = db.usableSize - 4
+			}
+			payload = append(payload, overflow[4:4+chunk]...)
+			overflowPage = int(binary.BigEndian.Uint32(overflow))
+		}
+	}
+
+	return decodeRecord(payload)
+}
+
+// cellOffsets returns the offsets of all cells of a b-tree page
+func cellOffsets(page []byte, headerOffset int) []int {
+	var count = int(binary.BigEndian.Uint16(page[headerOffset+3:]))
+	var pointers = headerOffset + 8
+	if page[headerOffset] == conPageInteriorIndex || page[headerOffset] == conPageInteriorTable {
+		pointers = headerOffset + 12
+	}
+
+	var offsets = make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		offsets = append(offsets, int(binary.BigEndian.Uint16(page[pointers+2*i:])))
+	}
+	return offsets
+}
+
+// decodeRecord decodes a record into its values, which are nil, int64, float64,
+// string or []byte
+func decodeRecord(payload []byte) ([]interface{}, error) {
+	var values []interface{}
+
+	headerSize, n := readVarint(payload)
+	if int(headerSize) > len(payload) {
+		return values, errors.New("invalid record in SQLite database")
+	}
+	var header = payload[n:headerSize]
+	var body = payload[headerSize:]
+
+	for len(header) > 0 {
+		serialType, n := readVarint(header)
+		header = header[n:]
+
+		// Size of the value
+		var size int
+		switch {
+		case serialType >= 1 && serialType <= 4:
+			size = int(serialType)
+		case serialType == 5:
+			size = 6
+		case serialType == 6 || serialType == 7:
+			size = 8
+		case serialType >= 12:
+			size = int(serialType-12) / 2
+		}
+		if size > len(body) {
+			return values, errors.New("invalid record in SQLite database")
+		}
+		var data = body[:size]
+		body = body[size:]
+
+		// Value
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType >= 1 && serialType <= 6:
+			// Big endian two's complement integer
+			var value = int64(int8(data[0]))
+			for _, b := range data[1:] {
+				value = value<<8 | int64(b)
+			}
+			values = append(values, value)
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(data)))
+		case serialType == 8:
+			values = append(values, int64(0))
+		case serialType == 9:
+			values = append(values, int64(1))
+		case serialType >= 12 && serialType%2 == 0:
+			values = append(values, data)
+		case serialType >= 13:
+			values = append(values, string(data))
+		default:
+			return values, errors.New("invalid record in SQLite database")
+		}
+	}
+
+	return values, nil
+}
+
+// readVarint reads a SQLite variable length integer, which is big endian and uses
+// all 8 bits of the ninth byte
+func readVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < 9 && i < len(data); i++ {
+		if i == 8 {
+			return value<<8 | uint64(data[i]), 9
+		}
+		value = value<<7 | uint64(data[i]&0x7f)
+		if data[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	return value, len(data)
+}
+
+// compareValues compares two values using the sort order of SQLite: NULL, numbers,
+// text, blobs
+func compareValues(a interface{}, b interface{}) int {
+	var class = func(value interface{}) int {
+		switch value.(type) {
+		case nil:
+			return 0
+		case int64, float64:
+			return 1
+		case string:
+			return 2
+		}
+		return 3
+	}
+	var number = func(value interface{}) float64 {
+		if i, ok := value.(int64); ok {
+			return float64(i)
+		}
+		return value.(float64)
+	}
+
+	if class(a) != class(b) {
+		return class(a) - class(b)
+	}
+	switch class(a) {
+	case 1:
+		// Compare integers directly to avoid rounding
+		ai, aIsInt := a.(int64)
+		bi, bIsInt := b.(int64)
+		switch {
+		case aIsInt && bIsInt && ai < bi, !(aIsInt && bIsInt) && number(a) < number(b):
+			return -1
+		case aIsInt && bIsInt && ai > bi, !(aIsInt && bIsInt) && number(a) > number(b):
+			return 1
+		}
+		return 0
+	case 2:
+		return strings.Compare(a.(string), b.(string))
+	case 3:
+		return bytes.Compare(a.([]byte), b.([]byte))
+	}
+	return 0
+}
+
+// parseColumns returns the column names of a CREATE TABLE statement, and the name
+// of the column which is an alias of the row ID (declared INTEGER PRIMARY KEY)
+func parseColumns(sql string) ([]string, string) {
+	var columns []string
+	var rowIDColumn string
+
+	for _, definition := range splitDefinitions(sql) {
+		var fields = strings.Fields(definition)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// Table constraints are no columns
+		switch strings.ToUpper(fields[0]) {
+		case "PRIMARY", "UNIQUE", "CHECK", "FOREIGN", "CONSTRAINT":
+			continue
+		}
+
+		var name = unquote(fields[0])
+		columns = append(columns, name)
+		if strings.Contains(strings.ToUpper(strings.Join(fields[1:], " ")), "INTEGER PRIMARY KEY") {
+			rowIDColumn = name
+		}
+	}
+
+	return columns, rowIDColumn
+}
+
+// parseIndexColumns returns the column names of a CREATE INDEX statement
+func parseIndexColumns(sql string) []string {
+	var columns []string
+	for _, definition := range splitDefinitions(sql) {
+		var fields = strings.Fields(definition)
+		if len(fields) > 0 {
+			columns = append(columns, unquote(fields[0]))
+		}
+	}
+	return columns
+}
+
+// splitDefinitions returns the comma separated parts between the outer parentheses
+// of a CREATE statement
+func splitDefinitions(sql string) []string {
+	var definitions []string
+	var start = strings.Index(sql, "(")
+	var end = strings.LastIndex(sql, ")")
+	if start < 0 || end <= start {
+		return definitions
+	}
+
+	var depth = 0
+	var current strings.Builder
+	for _, r := range sql[start+1 : end] {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			definitions = append(definitions, strings.TrimSpace(current.String()))
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	return append(definitions, strings.TrimSpace(current.String()))
+}
+
+// unquote removes the quotes around an SQL identifier
+func unquote(identifier string) string {
+	return strings.Trim(identifier, "\"'`[]")
+}
+
+// equalFoldAll compares two lists of identifiers case insensitively
+func equalFoldAll(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package mbtiles
+
+import "os"
+
+// MBTiles is a set of raster map tiles stored in a MBTiles file
+type MBTiles struct {
+	db           *database
+	minZoom      int
+	maxZoom      int
+	attribution  string
+	deduplicated bool
+}
+
+// database is a SQLite database file opened for reading
+type database struct {
+	file       *os.File
+	pageSize   int
+	usableSize int
+	schema     []schemaEntry
+}
+
+// schemaEntry is a table, index or view of a SQLite database
+type schemaEntry struct {
+	entryType string
+	name      string
+	tableName string
+	rootPage  int
+	sql       string
+}
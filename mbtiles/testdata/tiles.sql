@@ -0,0 +1,74 @@
+-- Test fixture for the MBTiles reader, build it with:
+--   sqlite3 tiles.mbtiles < tiles.sql
+-- The small page size makes the tables and the index span interior pages, the
+-- padded tile at zoom 3, column 0, row 7 does not fit into its page and needs
+-- overflow pages.
+PRAGMA page_size = 512;
+CREATE TABLE metadata (name text, value text);
+INSERT INTO metadata VALUES ('format', 'png'), ('minzoom', '3'), ('maxzoom', '3'), ('attribution', 'Test attribution');
+CREATE TABLE tiles (zoom_level integer, tile_column integer, tile_row integer, tile_data blob);
+CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row);
+INSERT INTO tiles VALUES (3, 0, 0, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63606060000000040001F61738550000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 0, 1, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6360906300000040001FB5082EFD0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 0, 2, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6360B0610000007C003D23F000920000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 0, 3, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63608862000000B8005B7647A8360000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 0, 4, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6360A860000000F40079B44EEE090000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 0, 5, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C636098C60000013000977C50CDA60000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 0, 6, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6360D8C20000016C00B51144BD680000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 0, 7, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE00000BC074455874436F6D6D656E740078787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787878787869CB131D0000000C49444154789C6360B8C4000001A800D39008D2180000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 1, 0, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C639063600000005E001F754A6A290000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 1, 1, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C639093630000009A003DF80F1B860000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 1, 2, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6390B361000000D6005B4BB7D8300000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 1, 3, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63908B62000001120079D70D92780000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 1, 4, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6390AB600000014E00979BF0F9AC0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 1, 5, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63909BC60000018A00B5798033FD0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 1, 6, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6390DBC2000001C600D3790365CA0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 1, 7, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6390BBC40000020200F19B4B20DD0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 2, 0, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B06160000000B8003DCD9102010000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 2, 1, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B09163000000F4005BDE43BC1F0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 2, 2, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B0B1610000013000794BD0D77D0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 2, 3, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B089620000016C00970E049D830000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 2, 4, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B0A960000001A800B5232B91840000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 2, 5, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B099C6000001E400D35FCC94640000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 2, 6, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B0D9C20000022000F1D36DA20C0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 2, 7, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B0B9C40000025C010F7EA348E30000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 3, 0, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6388626000000112005B1E751C960000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 3, 1, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C638892630000014E0079603084710000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 3, 2, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6388B2610000018A0097DFCD06ED0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 3, 3, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63888A62000001C600B514ED61F80000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 3, 4, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6388AA600000020200D35AC647980000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 3, 5, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63889AC60000023E00F10361AFA10000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 3, 6, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6388DAC20000027A010FEA3E82190000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 3, 7, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6388BAC4000002B6012D14D039580000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 4, 0, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63A860600000016C007955AE9DF60000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 4, 1, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63A89063000001A800974A3962C20000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 4, 2, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63A8B061000001E400B5883024FD0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 4, 3, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63A888620000022000D3CF3223B70000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 4, 4, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63A8A8600000025C00F1295080180000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 4, 5, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63A898C600000298010F5D5EE5F70000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 4, 6, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63A8D8C2000002D4012D2C6C36490000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 4, 7, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63A8B8C400000310014B159C3E5C0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 5, 0, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6398C6C0000001C60097C34B77880000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 5, 1, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C639826C70000020200B5D44FBCF10000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 5, 2, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C639866C30000023E00D3803D82960000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 5, 3, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C639816C50000027A00F1ED4E42C40000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 5, 4, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C639856C1000002B6010FEB3725440000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 5, 5, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6398368D010002F2012DD1D82DAF0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 5, 6, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C6398B6850100032E014B29F2894E0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 5, 7, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C639876890100036A01693607C0F50000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 6, 0, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63D8C2C00000022000B5F329386D0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 6, 1, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63D822C70000025C00D34C6476DB0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 6, 2, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63D862C30000029800F1D270EF5D0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 6, 3, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63D812C5000002D4010F276ED1090000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 6, 4, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63D852C100000310012D01C62FEA0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 6, 5, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63D8328D0100034C014B58AD50400000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 6, 6, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63D8B2850100038801697BBFE4850000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 6, 7, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63D87289010003C40187F88B721D0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 7, 0, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B8C4C00000027A00D3ACDFDF450000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 7, 1, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B824C7000002B600F1A77DEA6A0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 7, 2, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B864C3000002F2010F4E22C7D20000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 7, 3, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B814C50000032E012D68ED89AD0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 7, 4, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B854C10000036A014B667D8E220000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 7, 5, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B8348D010003A60169B3B4CCF10000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 7, 6, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B8B485010003E20187E341ED2F0000000049454E44AE426082');
+INSERT INTO tiles VALUES (3, 7, 7, X'89504E470D0A1A0A0000000D4948445200000001000000010802000000907753DE0000000C49444154789C63B874890100041E01A5AA2E33850000000049454E44AE426082');
@@ -0,0 +1,131 @@
+package picture
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"unicode"
+)
+
+// Size of a glyph of the built-in font in pixels, and the space between two glyphs
+const conGlyphWidth int = 5
+const conGlyphHeight int = 7
+const conGlyphSpacing int = 1
+
+// glyphs is a tiny bitmap font, so that we do not need any font files. It only
+// contains upper case letters, digits and some punctuation; lower case letters are
+// drawn as upper case letters.
+var glyphs = map[rune][conGlyphHeight]string{
+	'A':  {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'B':  {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'C':  {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'D':  {"####.", "#...#", "#...#", "#...#", "#...#", "#...#", "####."},
+	'E':  {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'F':  {"#####", "#....", "#....", "####.", "#....", "#....", "#...."},
+	'G':  {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".####"},
+	'H':  {"#...#", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'I':  {".###.", "..#..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'J':  {"..###", "...#.", "...#.", "...#.", "...#.", "#..#.", ".##.."},
+	'K':  {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'L':  {"#....", "#....", "#....", "#....", "#....", "#....", "#####"},
+	'M':  {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N':  {"#...#", "#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#"},
+	'O':  {".###.", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'P':  {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q':  {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R':  {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S':  {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T':  {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'U':  {"#...#", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'V':  {"#...#", "#...#", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'W':  {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "#.#.#", ".#.#."},
+	'X':  {"#...#", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "#...#"},
+	'Y':  {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#..", "..#.."},
+	'Z':  {"#####", "....#", "...#.", "..#..", ".#...", "#....", "#####"},
+	'0':  {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1':  {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2':  {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3':  {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4':  {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5':  {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6':  {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7':  {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8':  {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9':  {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	' ':  {".....", ".....", ".....", ".....", ".....", ".....", "....."},
+	'.':  {".....", ".....", ".....", ".....", ".....", ".##..", ".##.."},
+	',':  {".....", ".....", ".....", ".....", ".##..", "..#..", ".#..."},
+	':':  {".....", ".##..", ".##..", ".....", ".##..", ".##..", "....."},
+	'-':  {".....", ".....", ".....", "#####", ".....", ".....", "....."},
+	'+':  {".....", "..#..", "..#..", "#####", "..#..", "..#..", "....."},
+	'/':  {".....", "....#", "...#.", "..#..", ".#...", "#....", "....."},
+	'(':  {"...#.", "..#..", ".#...", ".#...", ".#...", "..#..", "...#."},
+	')':  {".#...", "..#..", "...#.", "...#.", "...#.", "..#..", ".#..."},
+	'\'': {"..#..", "..#..", ".#...", ".....", ".....", ".....", "....."},
+	'&':  {".##..", "#..#.", "#.#..", ".#...", "#.#.#", "#..#.", ".##.#"},
+	'!':  {"..#..", "..#..", "..#..", "..#..", "..#..", ".....", "..#.."},
+	'?':  {".###.", "#...#", "....#", "...#.", "..#..", ".....", "..#.."},
+	'%':  {"##...", "##..#", "...#.", "..#..", ".#...", "#..##", "...##"},
+	'©':  {".###.", "#...#", "#.###", "#.#.#", "#.###", "#...#", ".###."},
+}
+
+// fontReplacements maps characters which are not part of the built-in font onto
+// similar ones
+var fontReplacements = map[rune]rune{
+	'Ä': 'A', 'Á': 'A', 'À': 'A', 'Â': 'A', 'Å': 'A',
+	'Ç': 'C', 'É': 'E', 'È': 'E', 'Ê': 'E', 'Ë': 'E',
+	'Í': 'I', 'Ì': 'I', 'Î': 'I', 'Ï': 'I', 'Ñ': 'N',
+	'Ö': 'O', 'Ó': 'O', 'Ò': 'O', 'Ô': 'O', 'Ø': 'O',
+	'Ü': 'U', 'Ú': 'U', 'Ù': 'U', 'Û': 'U', 'ß': 'S', 'ẞ': 'S',
+	'_': '-', '"': '\'',
+}
+
+// textWidth returns the width of a text drawn with the built-in font in pixels
+func textWidth(text string, scale int) int {
+	var length = len([]rune(text))
+	if length == 0 {
+		return 0
+	}
+	return (length*(conGlyphWidth+conGlyphSpacing) - conGlyphSpacing) * scale
+}
+
+// drawText draws a text with the built-in font, with its top left corner at x, y.
+// Characters which are not part of the font are replaced by similar ones or by "?".
+func drawText(img draw.Image, x int, y int, text string, scale int, textColor color.Color) {
+	for _, r := range text {
+		glyph, ok := glyphs[fontRune(r)]
+		if !ok {
+			glyph = glyphs['?']
+		}
+
+		// Draw the glyph pixel by pixel
+		for row := 0; row < conGlyphHeight; row++ {
+			for column := 0; column < conGlyphWidth; column++ {
+				if glyph[row][column] == '#' {
+					var rect = image.Rect(x+column*scale, y+row*scale, x+(column+1)*scale, y+(row+1)*scale)
+					draw.Draw(img, rect, image.NewUniform(textColor), image.Point{}, draw.Over)
+				}
+			}
+		}
+		x = x + (conGlyphWidth+conGlyphSpacing)*scale
+	}
+}
+
+// fontRune maps a character onto one which is part of the built-in font
+func fontRune(r rune) rune {
+	r = unicode.ToUpper(r)
+	if replacement, ok := fontReplacements[r]; ok {
+		return replacement
+	}
+	return r
+}
+
+// truncateText shortens a text so that it fits into maxWidth pixels
+func truncateText(text string, scale int, maxWidth int) string {
+	var runes = []rune(strings.TrimSpace(text))
+	for len(runes) > 0 && textWidth(string(runes), scale) > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes)
+}
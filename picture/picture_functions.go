@@ -0,0 +1,418 @@
+package picture
+
+import (
+	"bytes"
+	_ "embed" // needed for the static route picture
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"strconv"
+
+	"github.com/Organized92/route2bimmer/gpx"
+)
+
+// Default size of the route picture in pixels, as expected by the navigation system
+const conDefaultWidth int = 252
+const conDefaultHeight int = 172
+
+// Quality of the encoded JPEG pictures
+const conJPEGQuality int = 90
+
+// staticPicture is the picture used if the route cannot be drawn
+//
+//go:embed routepicture.jpg
+var staticPicture []byte
+
+// defaultStyle contains the colors and sizes used to draw the route picture
+var defaultStyle = style{
+	background:   color.RGBA{242, 239, 233, 255},
+	track:        color.RGBA{0, 102, 204, 255},
+	route:        color.RGBA{120, 120, 120, 255},
+	text:         color.RGBA{40, 40, 40, 255},
+	textShadow:   color.RGBA{200, 200, 200, 200},
+	waypoint:     color.RGBA{80, 80, 80, 255},
+	always:       color.RGBA{255, 255, 255, 255},
+	start:        color.RGBA{40, 160, 60, 255},
+	end:          color.RGBA{200, 40, 40, 255},
+	border:       color.RGBA{40, 40, 40, 255},
+	profile:      color.RGBA{153, 194, 235, 255},
+	trackWidth:   3,
+	routeWidth:   1.5,
+	margin:       12,
+	markerRadius: 4,
+}
+
+// DefaultOptions returns the options for a picture in the size expected by the
+// navigation system, without caption
+func DefaultOptions() Options {
+	var options Options
+	options.Width = conDefaultWidth
+	options.Height = conDefaultHeight
+	return options
+}
+
+// Static returns the static route picture, which can be used if the route cannot
+// be drawn
+func Static() []byte {
+	return staticPicture
+}
+
+// Render draws the tracks and the route waypoints of the GPX file. Start and end of
+// the route are marked green and red, the other waypoints where the navigation
+// system stops are marked white. A scale bar is drawn in the lower left corner.
+func Render(gpxFile gpx.GPX, options Options) (*image.RGBA, error) {
+	var img = image.NewRGBA(image.Rect(0, 0, options.Width, options.Height))
+	var err error
+
+	if options.Width <= 0 || options.Height <= 0 {
+		return img, errors.New("invalid picture size")
+	}
+
+	// Fit all coordinates into the picture, leaving space for the scale bar at the
+	// bottom and the caption at the top
+	var margins = [4]float64{defaultStyle.margin, defaultStyle.margin, defaultStyle.margin, defaultStyle.margin}
+	margins[2] = margins[2] + float64(conGlyphHeight+8)
+	if options.Caption != "" {
+		margins[0] = margins[0] + float64(conGlyphHeight+8)
+	}
+	proj, err := fitProjection(gpxFile, options, margins)
+	if err != nil {
+		return img, err
+	}
+
+	// Background
+	draw.Draw(img, img.Bounds(), image.NewUniform(defaultStyle.background), image.Point{}, draw.Src)
+	if options.Tiles != nil {
+		// Use the scale of a zoom level, so that the tiles do not have to be resized
+		var zoom = int(math.Floor(math.Log2(proj.scale / conTileSize)))
+		proj = proj.withScale(conTileSize * math.Pow(2, float64(zoom)))
+		err = drawTiles(img, proj, zoom, options.Tiles)
+		if err != nil {
+			return img, err
+		}
+	}
+
+	// Route geometry
+	drawRoute(img, gpxFile, proj, defaultStyle)
+
+	// Scale bar, attribution and caption
+	drawScaleBar(img, proj, defaultStyle)
+	if options.Attribution != "" {
+		drawAttribution(img, options.Attribution, defaultStyle)
+	}
+	if options.Caption != "" {
+		drawCaption(img, options.Caption, defaultStyle)
+	}
+
+	return img, err
+}
+
+// EncodeJPEG encodes the picture as baseline JPEG
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: conJPEGQuality})
+	return buffer.Bytes(), err
+}
+
+// drawRoute draws the tracks and the route waypoints. If the file contains no
+// tracks, the route waypoints are connected by thin straight lines instead.
+func drawRoute(img *image.RGBA, gpxFile gpx.GPX, proj projection, s style) {
+	// Tracks
+	for _, track := range gpxFile.Tracks {
+		for _, segment := range track.Segments {
+			var line []pixel
+			for _, point := range segment.Points {
+				line = append(line, proj.toPixel(point.Latitude, point.Longitude))
+			}
+			drawPolyline(img, line, s.trackWidth, s.track)
+		}
+	}
+
+	// Straight lines between the route waypoints, if there is no track
+	if len(gpxFile.Tracks) == 0 {
+		for _, route := range gpxFile.Routes {
+			var line []pixel
+			for _, waypoint := range route.RouteWaypoints {
+				line = append(line, proj.toPixel(waypoint.Latitude, waypoint.Longitude))
+			}
+			drawPolyline(img, line, s.routeWidth, s.route)
+		}
+	}
+
+	// Optional waypoints first, so that they do not hide the important ones
+	for _, route := range gpxFile.Routes {
+		for rteWptIndex, waypoint := range route.RouteWaypoints {
+			if !route.IsAlways(rteWptIndex) {
+				var p = proj.toPixel(waypoint.Latitude, waypoint.Longitude)
+				fillCircle(img, p, s.markerRadius/2, s.waypoint)
+			}
+		}
+	}
+
+	// Waypoints where the navigation system stops: the first and the last of each
+	// route and the ones marked as always
+	for rteIndex, route := range gpxFile.Routes {
+		for rteWptIndex, waypoint := range route.RouteWaypoints {
+			var p = proj.toPixel(waypoint.Latitude, waypoint.Longitude)
+			var fill color.RGBA
+			switch {
+			case rteIndex == 0 && rteWptIndex == 0:
+				fill = s.start
+			case rteIndex == len(gpxFile.Routes)-1 && rteWptIndex == len(route.RouteWaypoints)-1:
+				fill = s.end
+			case route.IsAlways(rteWptIndex):
+				fill = s.always
+			default:
+				continue
+			}
+			fillCircle(img, p, s.markerRadius+1, s.border)
+			fillCircle(img, p, s.markerRadius, fill)
+		}
+	}
+}
+
+// drawScaleBar draws a scale bar with a round length in the lower left corner
+func drawScaleBar(img *image.RGBA, proj projection, s style) {
+	var bounds = img.Bounds()
+
+	// The scale bar should take about a quarter of the picture width
+	var metersPerPixel = proj.metersPerPixel(float64(bounds.Dy()) / 2)
+	var length = roundLength(metersPerPixel * float64(bounds.Dx()) / 4)
+	var barWidth = int(math.Round(length / metersPerPixel))
+	if barWidth <= 0 || barWidth > bounds.Dx() {
+		return
+	}
+
+	// Label
+	var label string
+	if length >= 1000 {
+		label = strconv.FormatFloat(length/1000, 'f', -1, 64) + " km"
+	} else {
+		label = strconv.FormatFloat(length, 'f', -1, 64) + " m"
+	}
+
+	var x = 6
+	var y = bounds.Dy() - 6
+	var bar = image.Rect(x, y-2, x+barWidth, y)
+	draw.Draw(img, bar.Inset(-1), image.NewUniform(s.textShadow), image.Point{}, draw.Over)
+	draw.Draw(img, bar, image.NewUniform(s.text), image.Point{}, draw.Over)
+	drawText(img, x, y-4-conGlyphHeight, label, 1, s.text)
+}
+
+// drawCaption draws the caption on a bright band at the top of the picture
+func drawCaption(img *image.RGBA, caption string, s style) {
+	var bounds = img.Bounds()
+	caption = truncateText(caption, 1, bounds.Dx()-8)
+
+	var band = image.Rect(0, 0, bounds.Dx(), conGlyphHeight+8)
+	draw.Draw(img, band, image.NewUniform(s.textShadow), image.Point{}, draw.Over)
+	drawText(img, 4, 4, caption, 1, s.text)
+}
+
+// drawAttribution draws the attribution of the map tiles in the lower right corner
+func drawAttribution(img *image.RGBA, attribution string, s style) {
+	var bounds = img.Bounds()
+	attribution = truncateText(attribution, 1, bounds.Dx()/2)
+
+	var width = textWidth(attribution, 1)
+	var band = image.Rect(bounds.Dx()-width-4, bounds.Dy()-conGlyphHeight-4, bounds.Dx(), bounds.Dy())
+	draw.Draw(img, band, image.NewUniform(s.textShadow), image.Point{}, draw.Over)
+	drawText(img, bounds.Dx()-width-2, bounds.Dy()-conGlyphHeight-2, attribution, 1, s.text)
+}
+
+// fitProjection returns a projection which fits all tracks and route waypoints
+// into the picture, keeping the margins at the top, right, bottom and left
+func fitProjection(gpxFile gpx.GPX, options Options, margins [4]float64) (projection, error) {
+	var proj projection
+	var minX, minY = math.Inf(1), math.Inf(1)
+	var maxX, maxY = math.Inf(-1), math.Inf(-1)
+
+	var latitudes, longitudes []float64
+	for _, track := range gpxFile.Tracks {
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				latitudes = append(latitudes, point.Latitude)
+				longitudes = append(longitudes, point.Longitude)
+			}
+		}
+	}
+	for _, route := range gpxFile.Routes {
+		for _, waypoint := range route.RouteWaypoints {
+			latitudes = append(latitudes, waypoint.Latitude)
+			longitudes = append(longitudes, waypoint.Longitude)
+		}
+	}
+	proj.west, _ = gpx.LongitudeRange(longitudes)
+	for i := range latitudes {
+		var x, y = mercator(latitudes[i], proj.unwrap(longitudes[i]))
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+
+	if math.IsInf(minX, 1) {
+		return proj, errors.New("there are no coordinates to draw")
+	}
+
+	// Use the same scale in both directions. A single point is shown at a scale
+	// of about 1 km across the picture.
+	var width = float64(options.Width) - margins[1] - margins[3]
+	var height = float64(options.Height) - margins[0] - margins[2]
+	var spanX = math.Max(maxX-minX, 1000/(360*gpx.MetersPerDegree()))
+	var spanY = math.Max(maxY-minY, 1000/(360*gpx.MetersPerDegree()))
+	proj.scale = math.Min(width/spanX, height/spanY)
+
+	// Center the route inside the margins
+	proj.center = pixel{margins[3] + width/2, margins[0] + height/2}
+	proj.offsetX = proj.center.x - (minX+maxX)/2*proj.scale
+	proj.offsetY = proj.center.y - (minY+maxY)/2*proj.scale
+
+	return proj, nil
+}
+
+// withScale returns a projection with another scale and the same center
+func (proj projection) withScale(scale float64) projection {
+	var result projection
+	var centerX = (proj.center.x - proj.offsetX) / proj.scale
+	var centerY = (proj.center.y - proj.offsetY) / proj.scale
+	result.scale = scale
+	result.center = proj.center
+	result.west = proj.west
+	result.offsetX = proj.center.x - centerX*scale
+	result.offsetY = proj.center.y - centerY*scale
+	return result
+}
+
+// toPixel converts a coordinate into a pixel position
+func (proj projection) toPixel(latitude float64, longitude float64) pixel {
+	var x, y = mercator(latitude, proj.unwrap(longitude))
+	return pixel{x*proj.scale + proj.offsetX, y*proj.scale + proj.offsetY}
+}
+
+// unwrap returns the longitude counted eastwards from the western edge, which may be
+// beyond 180 degrees
+func (proj projection) unwrap(longitude float64) float64 {
+	var east = math.Mod(longitude-proj.west, 360)
+	if east < 0 {
+		east = east + 360
+	}
+	return proj.west + east
+}
+
+// metersPerPixel returns the size of a pixel in meters at the vertical position y
+func (proj projection) metersPerPixel(y float64) float64 {
+	var latitude = inverseMercatorY((y - proj.offsetY) / proj.scale)
+	return 360 * gpx.MetersPerDegree() * math.Cos(latitude*math.Pi/180) / proj.scale
+}
+
+// mercator converts a coordinate into web mercator coordinates, where the whole world
+// is a square from 0 to 1 with the origin in the north west
+func mercator(latitude float64, longitude float64) (float64, float64) {
+	// Avoid infinite values at the poles
+	latitude = math.Max(-85.05112878, math.Min(85.05112878, latitude))
+	var phi = latitude * math.Pi / 180
+	var x = (longitude + 180) / 360
+	var y = (1 - math.Log(math.Tan(phi)+1/math.Cos(phi))/math.Pi) / 2
+	return x, y
+}
+
+// inverseMercatorY converts a web mercator y coordinate back into a latitude
+func inverseMercatorY(y float64) float64 {
+	return math.Atan(math.Sinh(math.Pi*(1-2*y))) * 180 / math.Pi
+}
+
+// roundLength rounds a length down to 1, 2 or 5 times a power of ten
+func roundLength(length float64) float64 {
+	if length <= 0 {
+		return 0
+	}
+	var power = math.Pow(10, math.Floor(math.Log10(length)))
+	switch {
+	case length >= 5*power:
+		return 5 * power
+	case length >= 2*power:
+		return 2 * power
+	default:
+		return power
+	}
+}
+
+// drawPolyline draws connected lines through all pixels
+func drawPolyline(img *image.RGBA, line []pixel, width float64, lineColor color.RGBA) {
+	if len(line) == 1 {
+		fillCircle(img, line[0], width/2, lineColor)
+	}
+	for i := 1; i < len(line); i++ {
+		drawLine(img, line[i-1], line[i], width, lineColor)
+	}
+}
+
+// drawLine draws a line of the given width with round ends. Pixels at the edge are
+// blended with the background depending on how much of them is covered.
+func drawLine(img *image.RGBA, from pixel, to pixel, width float64, lineColor color.RGBA) {
+	var bounds = img.Bounds()
+	var radius = width / 2
+	var minX = int(math.Floor(math.Min(from.x, to.x) - radius - 1))
+	var maxX = int(math.Ceil(math.Max(from.x, to.x) + radius + 1))
+	var minY = int(math.Floor(math.Min(from.y, to.y) - radius - 1))
+	var maxY = int(math.Ceil(math.Max(from.y, to.y) + radius + 1))
+
+	var dx = to.x - from.x
+	var dy = to.y - from.y
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			if !(image.Point{X: x, Y: y}).In(bounds) {
+				continue
+			}
+
+			// Distance between the center of the pixel and the line
+			var px = float64(x) + 0.5 - from.x
+			var py = float64(y) + 0.5 - from.y
+			var t float64
+			if dx != 0 || dy != 0 {
+				t = math.Max(0, math.Min(1, (px*dx+py*dy)/(dx*dx+dy*dy)))
+			}
+			var distance = math.Hypot(px-t*dx, py-t*dy)
+
+			var coverage = math.Max(0, math.Min(1, radius+0.5-distance))
+			if coverage > 0 {
+				blendPixel(img, x, y, lineColor, coverage)
+			}
+		}
+	}
+}
+
+// fillCircle draws a filled circle. Pixels at the edge are blended with the
+// background depending on how much of them is covered.
+func fillCircle(img *image.RGBA, center pixel, radius float64, fill color.RGBA) {
+	var bounds = img.Bounds()
+	var minX = int(math.Floor(center.x - radius - 1))
+	var maxX = int(math.Ceil(center.x + radius + 1))
+	var minY = int(math.Floor(center.y - radius - 1))
+	var maxY = int(math.Ceil(center.y + radius + 1))
+
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			if !(image.Point{X: x, Y: y}).In(bounds) {
+				continue
+			}
+			var distance = math.Hypot(float64(x)+0.5-center.x, float64(y)+0.5-center.y)
+			var coverage = math.Max(0, math.Min(1, radius+0.5-distance))
+			if coverage > 0 {
+				blendPixel(img, x, y, fill, coverage)
+			}
+		}
+	}
+}
+
+// blendPixel mixes a color into a pixel, coverage ranging from 0 to 1
+func blendPixel(img *image.RGBA, x int, y int, fill color.RGBA, coverage float64) {
+	var current = img.RGBAAt(x, y)
+	var alpha = coverage * float64(fill.A) / 255
+	var mix = func(a uint8, b uint8) uint8 {
+		return uint8(math.Round(float64(a)*(1-alpha) + float64(b)*alpha))
+	}
+	img.SetRGBA(x, y, color.RGBA{mix(current.R, fill.R), mix(current.G, fill.G), mix(current.B, fill.B), 255})
+}
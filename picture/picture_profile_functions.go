@@ -0,0 +1,161 @@
+package picture
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+
+	"github.com/Organized92/route2bimmer/gpx"
+)
+
+// profilePoint is a point of the elevation profile
+type profilePoint struct {
+	distance  float64
+	elevation float64
+}
+
+// RenderProfile draws the elevation profile of the tracks, with the distance on the
+// x-axis and the elevation on the y-axis. The lowest and the highest elevation and
+// the total distance are written next to the profile. If the file contains no
+// tracks, the route waypoints are used instead.
+func RenderProfile(gpxFile gpx.GPX, options Options) (*image.RGBA, error) {
+	var img = image.NewRGBA(image.Rect(0, 0, options.Width, options.Height))
+	var err error
+
+	if options.Width <= 0 || options.Height <= 0 {
+		return img, errors.New("invalid picture size")
+	}
+
+	// Elevations along the route
+	var points = profilePoints(gpxFile)
+	if len(points) < 2 || points[len(points)-1].distance <= 0 {
+		return img, errors.New("the GPX file contains no tracks or route waypoints to draw an elevation profile of")
+	}
+	var minElevation = points[0].elevation
+	var maxElevation = points[0].elevation
+	for _, point := range points {
+		minElevation = math.Min(minElevation, point.elevation)
+		maxElevation = math.Max(maxElevation, point.elevation)
+	}
+	if minElevation == maxElevation {
+		return img, errors.New("the GPX file contains no elevation data")
+	}
+
+	// Plot area, leaving space for the labels above and below it and the caption at
+	// the top
+	var s = defaultStyle
+	var top = 6 + conGlyphHeight + 6
+	if options.Caption != "" {
+		top = top + conGlyphHeight + 8
+	}
+	var plot = image.Rect(6, top, options.Width-6, options.Height-6-conGlyphHeight-6)
+	if plot.Dx() <= 0 || plot.Dy() <= 0 {
+		return img, errors.New("picture is too small for an elevation profile")
+	}
+
+	var totalDistance = points[len(points)-1].distance
+	var toPixel = func(point profilePoint) pixel {
+		return pixel{
+			float64(plot.Min.X) + point.distance/totalDistance*float64(plot.Dx()),
+			float64(plot.Max.Y) - (point.elevation-minElevation)/(maxElevation-minElevation)*float64(plot.Dy()),
+		}
+	}
+
+	// Background
+	draw.Draw(img, img.Bounds(), image.NewUniform(s.background), image.Point{}, draw.Src)
+
+	// Fill the area below the profile column by column
+	var index = 0
+	for x := plot.Min.X; x < plot.Max.X; x++ {
+		var distance = (float64(x-plot.Min.X) + 0.5) / float64(plot.Dx()) * totalDistance
+		for index < len(points)-2 && points[index+1].distance < distance {
+			index++
+		}
+
+		// Interpolate between the surrounding points
+		var from = points[index]
+		var to = points[index+1]
+		var elevation = from.elevation
+		if to.distance > from.distance {
+			elevation = from.elevation + (to.elevation-from.elevation)*(distance-from.distance)/(to.distance-from.distance)
+		}
+		var y = int(math.Round(toPixel(profilePoint{distance, elevation}).y))
+		draw.Draw(img, image.Rect(x, y, x+1, plot.Max.Y), image.NewUniform(s.profile), image.Point{}, draw.Over)
+	}
+
+	// Base line and profile line
+	draw.Draw(img, image.Rect(plot.Min.X, plot.Max.Y, plot.Max.X, plot.Max.Y+1), image.NewUniform(s.border), image.Point{}, draw.Over)
+	var line []pixel
+	for _, point := range points {
+		line = append(line, toPixel(point))
+	}
+	drawPolyline(img, line, s.routeWidth, s.track)
+
+	// Labels: highest elevation above the profile, lowest elevation and total
+	// distance below it
+	var maxLabel = "max " + strconv.FormatFloat(math.Round(maxElevation), 'f', 0, 64) + " m"
+	var minLabel = "min " + strconv.FormatFloat(math.Round(minElevation), 'f', 0, 64) + " m"
+	var distanceLabel = formatDistance(totalDistance)
+	drawText(img, plot.Min.X, plot.Min.Y-conGlyphHeight-4, maxLabel, 1, s.text)
+	drawText(img, plot.Min.X, plot.Max.Y+5, minLabel, 1, s.text)
+	drawText(img, plot.Max.X-textWidth(distanceLabel, 1), plot.Max.Y+5, distanceLabel, 1, s.text)
+
+	if options.Caption != "" {
+		drawCaption(img, options.Caption, s)
+	}
+
+	return img, err
+}
+
+// profilePoints returns the distance from the start and the elevation of all track
+// points, or of all route waypoints if there are no tracks
+func profilePoints(gpxFile gpx.GPX) []profilePoint {
+	var points []profilePoint
+	var latitudes []float64
+	var longitudes []float64
+	var elevations []float64
+
+	// Collect the coordinates, segments and routes are simply joined
+	for _, track := range gpxFile.Tracks {
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				latitudes = append(latitudes, point.Latitude)
+				longitudes = append(longitudes, point.Longitude)
+				elevations = append(elevations, point.Elevation)
+			}
+		}
+	}
+	if len(gpxFile.Tracks) == 0 {
+		for _, route := range gpxFile.Routes {
+			for _, waypoint := range route.RouteWaypoints {
+				latitudes = append(latitudes, waypoint.Latitude)
+				longitudes = append(longitudes, waypoint.Longitude)
+				elevations = append(elevations, waypoint.Elevation)
+			}
+		}
+	}
+
+	// Add up the distances
+	var distance float64
+	for i := range latitudes {
+		if i > 0 {
+			distance = distance + gpx.GreatCircleDistance(latitudes[i-1], longitudes[i-1], latitudes[i], longitudes[i])
+		}
+		points = append(points, profilePoint{distance, elevations[i]})
+	}
+
+	return points
+}
+
+// formatDistance formats a distance in meters or kilometers
+func formatDistance(distance float64) string {
+	if distance >= 10000 {
+		return strconv.FormatFloat(math.Round(distance/1000), 'f', 0, 64) + " km"
+	}
+	if distance >= 1000 {
+		return strconv.FormatFloat(distance/1000, 'f', 1, 64) + " km"
+	}
+	return strconv.FormatFloat(math.Round(distance), 'f', 0, 64) + " m"
+}
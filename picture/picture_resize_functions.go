@@ -0,0 +1,123 @@
+package picture
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // needed to decode GIF pictures
+	_ "image/png" // needed to decode PNG pictures
+	"math"
+	"os"
+	"strings"
+)
+
+// Maximum number of samples per direction used to calculate one pixel when
+// scaling down a picture
+const conMaxSamples int = 8
+
+// FromFile reads a PNG, JPEG or GIF picture and scales it so that it covers the
+// size given in the options. Whatever is left over is cropped equally on both
+// sides. Transparent areas become white.
+func FromFile(picturePath string, options Options) (*image.RGBA, error) {
+	// Read the picture
+	pictureFile, err := os.Open(picturePath)
+	if err != nil {
+		return nil, err
+	}
+	defer pictureFile.Close()
+
+	src, _, err := image.Decode(pictureFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return Fit(src, options), nil
+}
+
+// Info returns the encoding (e.g. "JPEG"), the width and the height of an encoded picture
+func Info(data []byte) (string, int, int, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	return strings.ToUpper(format), config.Width, config.Height, err
+}
+
+// Fit scales a picture so that it covers the size given in the options and crops
+// whatever is left over equally on both sides. Transparent areas become white.
+func Fit(src image.Image, options Options) *image.RGBA {
+	var dst = image.NewRGBA(image.Rect(0, 0, options.Width, options.Height))
+	var bounds = src.Bounds()
+	if bounds.Empty() || options.Width <= 0 || options.Height <= 0 {
+		return dst
+	}
+
+	// Put the picture onto a white background, so that we do not have to care
+	// about transparency any more
+	var opaque = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(opaque, opaque.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(opaque, opaque.Bounds(), src, bounds.Min, draw.Over)
+
+	// Scale factor from destination to source pixels, using the smaller side so
+	// that the picture covers the whole destination
+	var scale = math.Min(float64(bounds.Dx())/float64(options.Width), float64(bounds.Dy())/float64(options.Height))
+	var offsetX = (float64(bounds.Dx()) - float64(options.Width)*scale) / 2
+	var offsetY = (float64(bounds.Dy()) - float64(options.Height)*scale) / 2
+
+	// When scaling down, every destination pixel is the average of several samples
+	var samples = int(math.Min(float64(conMaxSamples), math.Max(1, math.Ceil(scale))))
+
+	for y := 0; y < options.Height; y++ {
+		for x := 0; x < options.Width; x++ {
+			var r, g, b float64
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					var srcX = offsetX + (float64(x)+(float64(sx)+0.5)/float64(samples))*scale
+					var srcY = offsetY + (float64(y)+(float64(sy)+0.5)/float64(samples))*scale
+					var c = bilinear(opaque, srcX, srcY)
+					r, g, b = r+c[0], g+c[1], b+c[2]
+				}
+			}
+			var count = float64(samples * samples)
+			dst.SetRGBA(x, y, color.RGBA{uint8(math.Round(r / count)), uint8(math.Round(g / count)), uint8(math.Round(b / count)), 255})
+		}
+	}
+
+	return dst
+}
+
+// bilinear returns the color at a position between the pixel centers of a picture
+func bilinear(img *image.RGBA, x float64, y float64) [3]float64 {
+	var bounds = img.Bounds()
+	var clamp = func(value int, max int) int {
+		if value < 0 {
+			return 0
+		}
+		if value >= max {
+			return max - 1
+		}
+		return value
+	}
+
+	// The four surrounding pixels and the weights of the right and bottom ones
+	var x0 = int(math.Floor(x - 0.5))
+	var y0 = int(math.Floor(y - 0.5))
+	var wx = x - 0.5 - float64(x0)
+	var wy = y - 0.5 - float64(y0)
+
+	var result [3]float64
+	for _, corner := range []struct {
+		x      int
+		y      int
+		weight float64
+	}{
+		{x0, y0, (1 - wx) * (1 - wy)},
+		{x0 + 1, y0, wx * (1 - wy)},
+		{x0, y0 + 1, (1 - wx) * wy},
+		{x0 + 1, y0 + 1, wx * wy},
+	} {
+		var c = img.RGBAAt(clamp(corner.x, bounds.Dx()), clamp(corner.y, bounds.Dy()))
+		result[0] = result[0] + float64(c.R)*corner.weight
+		result[1] = result[1] + float64(c.G)*corner.weight
+		result[2] = result[2] + float64(c.B)*corner.weight
+	}
+	return result
+}
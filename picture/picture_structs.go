@@ -0,0 +1,70 @@
+package picture
+
+import (
+	"image"
+	"image/color"
+)
+
+// Options controls how the route picture is rendered
+type Options struct {
+	// Width and Height of the picture in pixels
+	Width  int
+	Height int
+
+	// Caption is drawn at the top of the picture, if it is not empty
+	Caption string
+
+	// Tiles are drawn as map background, if set
+	Tiles TileSource
+
+	// Attribution of the map tiles, drawn in the lower right corner if not empty
+	Attribution string
+}
+
+// TileSource provides raster map tiles of 256x256 pixels in the web mercator tiling
+// scheme with the origin in the north west
+type TileSource interface {
+	// Tile returns the tile with the given coordinates, or nil if it does not exist
+	Tile(zoom int, x int, y int) (image.Image, error)
+
+	// ZoomRange returns the lowest and the highest zoom level available
+	ZoomRange() (int, int)
+}
+
+// style contains the colors and sizes used to draw the route picture
+type style struct {
+	background   color.RGBA
+	track        color.RGBA
+	route        color.RGBA
+	text         color.RGBA
+	textShadow   color.RGBA
+	waypoint     color.RGBA
+	always       color.RGBA
+	start        color.RGBA
+	end          color.RGBA
+	border       color.RGBA
+	profile      color.RGBA
+	trackWidth   float64
+	routeWidth   float64
+	margin       float64
+	markerRadius float64
+}
+
+// projection converts coordinates into pixel positions of the picture, using the
+// web mercator projection
+type projection struct {
+	scale   float64
+	offsetX float64
+	offsetY float64
+	center  pixel
+
+	// west is the western edge of the drawn area, longitudes are counted eastwards
+	// from it, so that routes across the antimeridian stay in one piece
+	west float64
+}
+
+// pixel is a position inside the picture
+type pixel struct {
+	x float64
+	y float64
+}
@@ -0,0 +1,69 @@
+package picture
+
+import (
+	"image"
+	"math"
+)
+
+// Size of a map tile in pixels
+const conTileSize float64 = 256
+
+// drawTiles draws the map tiles as background of the picture. The projection has
+// to use the scale of the given zoom level. If the tile source does not have this
+// zoom level, the nearest one is used and the tiles are scaled.
+func drawTiles(img *image.RGBA, proj projection, zoom int, tiles TileSource) error {
+	var bounds = img.Bounds()
+
+	// Zoom level of the tiles
+	var minZoom, maxZoom = tiles.ZoomRange()
+	var tileZoom = zoom
+	if tileZoom < minZoom {
+		tileZoom = minZoom
+	}
+	if tileZoom > maxZoom {
+		tileZoom = maxZoom
+	}
+	var tileCount = 1 << uint(tileZoom)
+	var worldSize = conTileSize * float64(tileCount)
+
+	// Tiles are read only once
+	type tileKey struct{ x, y int }
+	var cache = make(map[tileKey]image.Image)
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			// Position of the pixel center in pixels of the tile zoom level
+			var worldX = (float64(x) + 0.5 - proj.offsetX) / proj.scale * worldSize
+			var worldY = (float64(y) + 0.5 - proj.offsetY) / proj.scale * worldSize
+			if worldY < 0 || worldY >= worldSize {
+				continue
+			}
+
+			// The world repeats in east-west direction
+			var key = tileKey{int(math.Floor(worldX / conTileSize)), int(math.Floor(worldY / conTileSize))}
+			key.x = ((key.x % tileCount) + tileCount) % tileCount
+
+			tile, ok := cache[key]
+			if !ok {
+				var err error
+				tile, err = tiles.Tile(tileZoom, key.x, key.y)
+				if err != nil {
+					return err
+				}
+				cache[key] = tile
+			}
+			if tile == nil {
+				continue
+			}
+
+			// Nearest pixel of the tile, which may have another size than 256x256
+			var tileBounds = tile.Bounds()
+			var tileX = math.Mod(math.Mod(worldX, conTileSize)+conTileSize, conTileSize) / conTileSize
+			var tileY = math.Mod(worldY, conTileSize) / conTileSize
+			var c = tile.At(tileBounds.Min.X+int(tileX*float64(tileBounds.Dx())), tileBounds.Min.Y+int(tileY*float64(tileBounds.Dy())))
+			img.Set(x, y, c)
+		}
+	}
+
+	return nil
+}
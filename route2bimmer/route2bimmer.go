@@ -5,19 +5,56 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
-	"time"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Organized92/route2bimmer/bmw"
+	"github.com/Organized92/route2bimmer/elevation"
+	"github.com/Organized92/route2bimmer/geocode"
 	"github.com/Organized92/route2bimmer/gpx"
+	"github.com/Organized92/route2bimmer/mbtiles"
+	"github.com/Organized92/route2bimmer/picture"
 )
 
+// Range of the 7-digit route IDs
+const conMinRouteID int64 = 1000000
+const conMaxRouteID int64 = 9999999
+
+// Creation time of reproducible routes without any other time, the earliest time a
+// zip file can store
+var conReproducibleTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Command line options which are not part of the hashed route ID, because they do
+// not change the contents of the route. The input file is hashed on its own.
+var unhashedOptions = map[string]bool{
+	"input": true, "output": true, "route-id": true, "id-mode": true, "existing": true,
+	"creation-time": true, "stops": true, "inspect": true, "stats": true,
+}
+
+// Command line options naming files or directories which change the contents of the
+// route. Their contents are part of the hashed route ID instead of their paths, as the
+// paths differ between computers.
+var hashedFileOptions = map[string]bool{
+	"addresses": true, "osm": true, "picture": true, "tiles": true, "elevation-data": true,
+}
+
+// Source of the random route IDs, seeded once
+var routeIDRandom = rand.New(rand.NewSource(time.Now().UnixNano()))
+
 type fileData struct {
 	filename string
 	content  []byte
@@ -34,6 +71,54 @@ func main() {
 	// ***************************************************************************
 	inputPtr := flag.String("input", "", "path to input file")
 	outputPtr := flag.String("output", "", "path to output zip file")
+	addressesPtr := flag.String("addresses", "", "path to CSV file containing addresses of the route waypoints (optional)")
+	osmPtr := flag.String("osm", "", "path to OpenStreetMap extract (.osm.pbf) used to look up the addresses of the route waypoints (optional)")
+	routeIDPtr := flag.Int64("route-id", 0, "ID of the route (optional, generated according to -id-mode if not set)")
+	idModePtr := flag.String("id-mode", "random", "how to generate the route ID: \"random\" or \"hash\" (derived from the GPX file and the options, for reproducible output)")
+	existingPtr := flag.String("existing", "", "path to a BMWData folder or route zip file whose route IDs must not be reused (optional)")
+	creationTimePtr := flag.String("creation-time", "", "creation time of the route in RFC 3339 format, e.g. 2020-05-01T10:00:00Z (optional, otherwise taken from SOURCE_DATE_EPOCH or the GPX metadata, else the current time or 1980-01-01 with -id-mode=hash)")
+	picturePtr := flag.String("picture", "", "path to a PNG, JPEG or GIF picture used as route picture (optional, scaled and cropped as needed)")
+	headUnitPtr := flag.String("head-unit", "nbtevo", "navigation system the route is created for: "+strings.Join(bmw.HeadUnitNames(), ", "))
+	staticPicturePtr := flag.Bool("static-picture", false, "use the static route picture instead of drawing the route")
+	captionPtr := flag.Bool("picture-caption", false, "draw the name of the route onto the route picture")
+	tilesPtr := flag.String("tiles", "", "path to MBTiles file with raster map tiles drawn behind the route picture (optional)")
+	tilesAttributionPtr := flag.String("tiles-attribution", "", "attribution drawn onto the route picture when using -tiles (optional, taken from the MBTiles file if not set)")
+	profilePtr := flag.Bool("elevation-profile", true, "add a picture of the elevation profile, unless the head unit is known to show only one picture")
+	constraintsPtr := flag.String("constraints", "fix", "how to handle data exceeding the limits of the head unit: \"fix\" (shorten, round and thin out as needed), \"strict\" (fail with a report) or \"off\"")
+	distancePtr := flag.String("distance", gpx.DistanceGeodesic, "how to calculate the length of the tracks: \""+gpx.DistanceGeodesic+"\" (WGS84 ellipsoid) or \""+gpx.DistanceSphere+"\"")
+	distance2DPtr := flag.Bool("distance-2d", false, "ignore the elevation when calculating the length of the tracks")
+	smoothingPtr := flag.Float64("elevation-smoothing", 0, "average the elevations over this many meters when calculating the length of the tracks, to reduce GPS noise (optional)")
+	coordinatesPtr := flag.String("coordinates", "fix", "how to handle invalid coordinates (out of range, swapped latitude and longitude, 0,0): \"fix\" (swap back and remove invalid track points), \"strict\" (fail with a report) or \"off\"")
+	elevationDataPtr := flag.String("elevation-data", "", "path to a directory with SRTM tiles (.hgt or .hgt.zip) used to fill in the elevations of tracks and routes without elevation data (optional)")
+	cleanPtr := flag.Bool("clean", true, "remove GPS errors from the tracks before calculating length and duration: empty segments, duplicate points, out-of-order timestamps and outliers")
+	cleanMaxSpeedPtr := flag.Float64("clean-max-speed", 300, "speed in km/h above which a track point the track jumps to and back is removed by -clean")
+	cleanMaxJumpPtr := flag.Float64("clean-max-jump", 5000, "distance in meters above which a track point without timestamp the track jumps to and back is removed by -clean")
+	cleanSmoothingPtr := flag.Float64("clean-elevation-smoothing", 0, "average the elevations of the track points over this many meters when using -clean (optional)")
+	speedProfilePtr := flag.String("speed-profile", "car", "speed profile used to estimate the duration of tracks without timestamps: "+strings.Join(gpx.SpeedProfileNames(), ", "))
+	averageSpeedPtr := flag.String("average-speed", "", "average speed in km/h used to calculate the duration, one value for all routes or comma separated values per route, e.g. 60,45 (optional)")
+	durationPtr := flag.String("duration", "moving", "how to calculate the duration of recorded tracks: \"moving\" (without stops) or \"elapsed\" (from the first to the last timestamp)")
+	stopSpeedPtr := flag.Float64("stop-speed", 3, "speed in km/h below which a recorded track is considered standing")
+	stopDurationPtr := flag.Duration("stop-duration", 3*time.Minute, "minimum duration of a stop in a recorded track, e.g. 3m")
+	stopsPtr := flag.String("stops", "", "path to CSV file the stops found in the recorded tracks are written to (optional)")
+	legDescriptionsPtr := flag.Bool("leg-descriptions", false, "add distance and duration of the leg ending at a waypoint to its description")
+	statsPtr := flag.String("stats", "", "print statistics about the routes (length, climbs, hairpins, twistiness) as \"text\" or \"json\" instead of creating the route file (optional)")
+	statsTextsPtr := flag.Bool("stats-texts", false, "use the statistics as introduction and description of the route, if the GPX file does not contain any")
+	inspectPtr := flag.Bool("inspect", false, "print a report about the routes and their legs instead of creating the route file")
+	snapPtr := flag.Bool("snap", false, "move the route waypoints onto the track of the route, keeping the original position in the description")
+	divergencePtr := flag.Float64("divergence-distance", 1000, "distance in meters from every track from which on a route waypoint is reported and not moved by -snap")
+	routePtr := flag.Int("route", 0, "number of the route -waypoints, -trim-waypoints, -trim-distance, -start-at and -reverse apply to (0: all routes)")
+	waypointsPtr := flag.String("waypoints", "", "numbers of the waypoints to keep, in the new order, e.g. 1,3,2,5 (optional)")
+	trimWaypointsPtr := flag.String("trim-waypoints", "", "keep only the waypoints in this range, e.g. 2-5 (optional)")
+	trimDistancePtr := flag.String("trim-distance", "", "keep only the part of the route between these kilometers, e.g. 20-80 or 20- (optional)")
+	startAtPtr := flag.Int("start-at", 0, "number of the waypoint a roundtrip starts at (optional)")
+	reversePtr := flag.Bool("reverse", false, "reverse the direction of the route and its track")
+	roundtripPtr := flag.String("roundtrip", gpx.RoundtripMidpoint, "how to handle routes whose start and end coincide: \""+gpx.RoundtripMidpoint+"\" (stop at the point farthest away), \""+gpx.RoundtripSplit+"\" (outbound and return route) or \"off\"")
+	roundtripRadiusPtr := flag.Float64("roundtrip-radius", 200, "distance in meters between start and end up to which a route is a roundtrip")
+	shapingPtr := flag.Bool("shaping", false, "add optional waypoints from the track at turns and where the track leaves the straight line, so that the navigation system follows the intended roads")
+	shapingWaypointsPtr := flag.Int("shaping-waypoints", 0, "maximum number of waypoints per route when using -shaping (optional, the limit of the head unit if not set)")
+	shapingSpacingPtr := flag.Float64("shaping-spacing", 10000, "maximum distance in meters between two waypoints when using -shaping")
+	shortcutsPtr := flag.String("shortcuts", "warn", "what to do if the navigation system will probably take a shortcut: \"warn\", \"fix\" (add waypoints to stop at) or \"off\"")
+	languagePtr := flag.String("language", "en", "language of texts in the GPX file without xml:lang (ISO 639-1 or ISO 639-2 code)")
 	flag.Parse()
 
 	// Check if we have to read the input data from stdin or from a file
@@ -45,76 +130,541 @@ func main() {
 		if *inputPtr == "" && *outputPtr != "" {
 			log.Fatalln("Please specify the input GPX file. Use -h for more information.")
 		}
-		if *inputPtr != "" && *outputPtr == "" {
+		if *inputPtr != "" && *outputPtr == "" && *inspectPtr == false && *statsPtr == "" {
 			log.Fatalln("Please specify the output ZIP file. Use -h for more information.")
 		}
 		directio = false
 	}
 
+	// Check route ID arguments
+	if *routeIDPtr < 0 {
+		log.Fatalln("Please specify a positive route ID. Use -h for more information.")
+	}
+	if *routeIDPtr > conMaxRouteID {
+		log.Fatalln("Please specify a route ID with at most 7 digits. Use -h for more information.")
+	}
+	if *idModePtr != "random" && *idModePtr != "hash" {
+		log.Fatalln("Please specify a valid ID mode. Use -h for more information.")
+	}
+
+	// Check distance arguments
+	if *distancePtr != gpx.DistanceGeodesic && *distancePtr != gpx.DistanceSphere {
+		log.Fatalln("Please specify a valid distance method. Use -h for more information.")
+	}
+	if *smoothingPtr < 0 {
+		log.Fatalln("Please specify a positive elevation smoothing. Use -h for more information.")
+	}
+
+	// Check coordinate mode
+	if *coordinatesPtr != "fix" && *coordinatesPtr != "strict" && *coordinatesPtr != "off" {
+		log.Fatalln("Please specify a valid coordinate mode. Use -h for more information.")
+	}
+
+	// Check statistics format
+	if *statsPtr != "" && *statsPtr != "text" && *statsPtr != "json" {
+		log.Fatalln("Please specify a valid statistics format. Use -h for more information.")
+	}
+
+	// Check cleaning arguments
+	if *cleanMaxSpeedPtr <= 0 || *cleanMaxJumpPtr <= 0 || *cleanSmoothingPtr < 0 {
+		log.Fatalln("Please specify positive cleaning limits. Use -h for more information.")
+	}
+
+	// Check duration arguments
+	speedProfile, err := gpx.SpeedProfileByName(*speedProfilePtr)
+	if err != nil {
+		log.Fatalln("Please specify a valid speed profile. Use -h for more information.")
+	}
+	routeSpeeds, err := parseAverageSpeeds(*averageSpeedPtr)
+	if err != nil {
+		log.Fatalln("Please specify valid average speeds. Use -h for more information.")
+	}
+
+	if *durationPtr != "moving" && *durationPtr != "elapsed" {
+		log.Fatalln("Please specify a valid duration mode. Use -h for more information.")
+	}
+	if *stopSpeedPtr <= 0 || *stopDurationPtr <= 0 {
+		log.Fatalln("Please specify a positive stop speed and duration. Use -h for more information.")
+	}
+
+	// Check snapping arguments
+	if *divergencePtr <= 0 {
+		log.Fatalln("Please specify a positive divergence distance. Use -h for more information.")
+	}
+
+	// Check editing arguments
+	if *routePtr < 0 || *startAtPtr < 0 {
+		log.Fatalln("Please specify a positive route and start waypoint. Use -h for more information.")
+	}
+	selectedWaypoints, err := parseWaypointNumbers(*waypointsPtr)
+	if err != nil {
+		log.Fatalln("Please specify valid waypoint numbers. Use -h for more information.")
+	}
+	trimWaypointsFrom, trimWaypointsTo, err := parseRange(*trimWaypointsPtr)
+	if err != nil || trimWaypointsFrom != float64(int(trimWaypointsFrom)) || trimWaypointsTo != float64(int(trimWaypointsTo)) {
+		log.Fatalln("Please specify a valid waypoint range. Use -h for more information.")
+	}
+	trimDistanceFrom, trimDistanceTo, err := parseRange(*trimDistancePtr)
+	if err != nil {
+		log.Fatalln("Please specify a valid distance range. Use -h for more information.")
+	}
+
+	// Check roundtrip arguments
+	if *roundtripPtr != gpx.RoundtripMidpoint && *roundtripPtr != gpx.RoundtripSplit && *roundtripPtr != "off" {
+		log.Fatalln("Please specify a valid roundtrip mode. Use -h for more information.")
+	}
+	if *roundtripRadiusPtr <= 0 {
+		log.Fatalln("Please specify a positive roundtrip radius. Use -h for more information.")
+	}
+
+	// Check shaping arguments
+	if *shapingWaypointsPtr < 0 || *shapingSpacingPtr <= 0 {
+		log.Fatalln("Please specify a positive number of shaping waypoints and shaping spacing. Use -h for more information.")
+	}
+
+	// Check shortcut mode
+	if *shortcutsPtr != "warn" && *shortcutsPtr != "fix" && *shortcutsPtr != "off" {
+		log.Fatalln("Please specify a valid shortcut mode. Use -h for more information.")
+	}
+
+	// Check constraint mode
+	if *constraintsPtr != "fix" && *constraintsPtr != "strict" && *constraintsPtr != "off" {
+		log.Fatalln("Please specify a valid constraint mode. Use -h for more information.")
+	}
+
+	// The head unit has to be known
+	headUnit, err := bmw.HeadUnitByName(*headUnitPtr)
+	if err != nil {
+		log.Fatalln("Please specify a valid head unit. Use -h for more information.")
+	}
+
+	// The language has to be known to the navigation system
+	if _, err = bmw.LanguageCode(*languagePtr); err != nil {
+		log.Fatalln("Please specify a valid language. Use -h for more information.")
+	}
+
 	// ***************************************************************************
 	// Read and interpret GPX file
 	// ***************************************************************************
-	var gpxFile gpx.GPX
+	// The raw contents are kept for the hashed route ID
+	var gpxData []byte
 	if directio == true {
 		// Read from STDIN
-		gpxFile, err = gpx.FromStdin()
+		gpxData, err = ioutil.ReadAll(os.Stdin)
 		if err != nil {
 			log.Println("Could not read fom STDIN!")
 			log.Fatalln(err)
 		}
 	} else {
 		// Read from file
-		gpxFile, err = gpx.FromFile(inputPtr)
+		gpxData, err = ioutil.ReadFile(*inputPtr)
 		if err != nil {
 			log.Println("Could not read the GPX file!")
 			log.Fatalln(err)
 		}
 	}
+	gpxFile, err := gpx.FromBytes(gpxData)
+	if err != nil {
+		log.Println("Could not read the GPX file!")
+		log.Fatalln(err)
+	}
+
+	// Invalid coordinates would end up in the route file
+	if *coordinatesPtr != "off" {
+		problems, err := gpxFile.ValidateCoordinates(*coordinatesPtr == "fix")
+		for _, problem := range problems {
+			if problem.Fixed {
+				log.Println(problem)
+			}
+		}
+		if err != nil {
+			log.Println("The GPX file contains invalid coordinates!")
+			log.Fatalln(err)
+		}
+	}
+
+	// Planned routes often come without elevations
+	if *elevationDataPtr != "" {
+		provider, err := elevation.FromDirectory(*elevationDataPtr)
+		if err != nil {
+			log.Println("Could not open the elevation data!")
+			log.Fatalln(err)
+		}
+		filled, missingTiles, err := provider.FillElevations(&gpxFile)
+		if err != nil {
+			log.Println("Could not read the elevation data!")
+			log.Fatalln(err)
+		}
+		if filled > 0 {
+			log.Println("Filled in the elevation of " + strconv.Itoa(filled) + " points")
+		}
+		if len(missingTiles) > 0 {
+			log.Println("Warning: the elevation data is missing the tiles " + strings.Join(missingTiles, ", ") + "!")
+		}
+	}
+
+	// GPS errors inflate length and duration
+	if *cleanPtr == true {
+		for _, change := range gpxFile.Clean(gpx.CleanOptions{MaxSpeed: *cleanMaxSpeedPtr, MaxJump: *cleanMaxJumpPtr, ElevationSmoothing: *cleanSmoothingPtr}) {
+			log.Println(change)
+		}
+	}
+
+	// Read the addresses of the waypoints
+	if *addressesPtr != "" {
+		err = gpxFile.AddressesFromFile(*addressesPtr)
+		if err != nil {
+			log.Println("Could not read the addresses of the waypoints!")
+			log.Fatalln(err)
+		}
+	}
+
+	// Look up missing addresses in the OpenStreetMap extract
+	if *osmPtr != "" {
+		geocoder, err := geocode.FromFile(*osmPtr)
+		var cacheError *geocode.CacheError
+		if errors.As(err, &cacheError) {
+			log.Println("Warning: " + cacheError.Error() + ", it will be built again next time!")
+		} else if err != nil {
+			log.Println("Could not read the OpenStreetMap extract!")
+			log.Fatalln(err)
+		}
+		geocoder.FillAddresses(&gpxFile)
+	}
 
-	// Generate random ID for this route
-	routeID := generateRandomID()
+	// Route waypoints far away from every track mean that route and track disagree
+	var snapOptions = gpx.SnapOptions{MaxDistance: *divergencePtr}
+	for _, divergence := range gpxFile.FindDivergences(snapOptions) {
+		var route = gpxFile.Routes[divergence.Route]
+		log.Println("Warning: waypoint " + strconv.Itoa(divergence.Waypoint+1) + " \"" + route.RouteWaypoints[divergence.Waypoint].Name + "\" of route " + strconv.Itoa(divergence.Route+1) + " \"" + route.Name + "\" is " + bmw.DistanceText(divergence.Distance) + " away from the nearest track!")
+	}
+
+	// Matching the tracks to the routes is expensive, so it is done once here. Every
+	// step changing the routes keeps the matches up to date, or they are matched
+	// again after it.
+	var trackMatches = gpxFile.MatchTracks()
+
+	// Planners often put waypoints beside the road
+	if *snapPtr == true {
+		for _, snapped := range gpxFile.SnapWaypoints(trackMatches, snapOptions) {
+			var route = gpxFile.Routes[snapped.Route]
+			log.Println("Moved waypoint " + strconv.Itoa(snapped.Waypoint+1) + " \"" + route.RouteWaypoints[snapped.Waypoint].Name + "\" of route " + strconv.Itoa(snapped.Route+1) + " \"" + route.Name + "\" by " + strconv.FormatFloat(snapped.Distance, 'f', 0, 64) + " m onto the track")
+		}
+	}
+
+	// Edit the routes, e.g. to ride them backwards or to start halfway through
+	var editedRoutes []int
+	if *routePtr == 0 {
+		for i := range gpxFile.Routes {
+			editedRoutes = append(editedRoutes, i)
+		}
+	} else {
+		err = gpxFile.CheckRouteIndex(*routePtr - 1)
+		if err != nil {
+			log.Println("Route given in -route not found!")
+			log.Fatalln(err)
+		}
+		editedRoutes = append(editedRoutes, *routePtr-1)
+	}
+	for _, routeIndex := range editedRoutes {
+		if len(selectedWaypoints) > 0 {
+			err = gpxFile.SelectWaypoints(routeIndex, selectedWaypoints, trackMatches)
+		}
+		if err == nil && *trimWaypointsPtr != "" {
+			var from = int(trimWaypointsFrom) - 1
+			if from < 0 {
+				from = 0
+			}
+			var to = int(trimWaypointsTo) - 1
+			if trimWaypointsTo == 0 {
+				to = len(gpxFile.Routes[routeIndex].RouteWaypoints) - 1
+			}
+			err = gpxFile.TrimWaypoints(routeIndex, from, to, trackMatches)
+		}
+		if err == nil && *trimDistancePtr != "" {
+			err = gpxFile.TrimDistance(routeIndex, trimDistanceFrom*1000, trimDistanceTo*1000, trackMatches)
+		}
+		if err == nil && *startAtPtr > 0 {
+			err = gpxFile.RotateRoute(routeIndex, *startAtPtr-1, *roundtripRadiusPtr, trackMatches)
+		}
+		if err == nil && *reversePtr == true && *routePtr != 0 {
+			err = gpxFile.ReverseRoute(routeIndex, trackMatches)
+		}
+		if err != nil {
+			log.Println("Could not edit route " + strconv.Itoa(routeIndex+1) + "!")
+			log.Fatalln(err)
+		}
+	}
+	if *reversePtr == true && *routePtr == 0 {
+		gpxFile.Reverse()
+		trackMatches = gpxFile.MatchTracks()
+	}
+
+	// The navigation system cannot handle routes ending where they start
+	if *roundtripPtr != "off" {
+		changes, err := gpxFile.RestructureRoundtrips(trackMatches, gpx.RoundtripOptions{Radius: *roundtripRadiusPtr, Mode: *roundtripPtr})
+		if err != nil {
+			log.Println("Could not restructure the roundtrips!")
+			log.Fatalln(err)
+		}
+		for _, change := range changes {
+			log.Println(change)
+		}
+		if len(changes) > 0 {
+			trackMatches = gpxFile.MatchTracks()
+		}
+	}
+
+	// Without a track the navigation system only follows the waypoints, so the
+	// roads of the track are fixed with additional waypoints
+	if *shapingPtr == true {
+		var shapingOptions = gpx.ShapingOptions{MaxWaypoints: *shapingWaypointsPtr, Spacing: *shapingSpacingPtr}
+		if shapingOptions.MaxWaypoints == 0 {
+			shapingOptions.MaxWaypoints = headUnit.MaxWaypoints
+		}
+		for i, added := range gpxFile.AddShapingWaypoints(trackMatches, shapingOptions) {
+			if added > 0 {
+				log.Println("Added " + strconv.Itoa(added) + " shaping waypoints to route " + strconv.Itoa(i+1) + " \"" + gpxFile.Routes[i].Name + "\"")
+			}
+		}
+	}
+
+	// The navigation system takes shortcuts to waypoints close to the route
+	if *shortcutsPtr == "fix" {
+		for _, risk := range gpxFile.PreventShortcuts(trackMatches, gpx.ShortcutOptions{}) {
+			log.Println(describeShortcutRisk(gpxFile, risk) + ", added a waypoint to stop at " + formatCoordinates(risk.Suggestion.Latitude, risk.Suggestion.Longitude))
+		}
+	} else if *shortcutsPtr == "warn" {
+		for _, risk := range gpxFile.FindShortcutRisks(trackMatches, gpx.ShortcutOptions{}) {
+			log.Println("Warning: " + describeShortcutRisk(gpxFile, risk) + ", consider adding a waypoint to stop at " + formatCoordinates(risk.Suggestion.Latitude, risk.Suggestion.Longitude) + " or use -shortcuts=fix")
+		}
+	}
+
+	// Make sure the head unit is able to handle the route
+	if *constraintsPtr != "off" {
+		violations, err := bmw.CheckConstraints(&gpxFile, headUnit, *constraintsPtr == "fix")
+		if err != nil {
+			log.Println("The route exceeds the limits of the head unit!")
+			log.Fatalln(err)
+		}
+		for _, violation := range violations {
+			log.Println(violation)
+		}
+		if len(violations) > 0 {
+			trackMatches = gpxFile.MatchTracks()
+		}
+	}
+
+	// Every route should have a track, otherwise length and duration are only
+	// estimated from the straight lines between the waypoints
+	if len(gpxFile.Tracks) > 0 {
+		for i, route := range gpxFile.Routes {
+			var match = trackMatches[i]
+			if match.Matched() {
+				log.Println("Route " + strconv.Itoa(i+1) + " \"" + route.Name + "\" follows track " + strconv.Itoa(match.TrackIndex+1) + " \"" + gpxFile.Tracks[match.TrackIndex].Name + "\" (confidence " + strconv.FormatFloat(match.Confidence*100, 'f', 0, 64) + " %)")
+			} else {
+				log.Println("Warning: no track matches route " + strconv.Itoa(i+1) + " \"" + route.Name + "\", its length and duration are estimated from the waypoints!")
+			}
+		}
+	}
 
 	// ***************************************************************************
-	// Generate contents for XML file in folder "Nav" and "Navigation"
+	// Determine the ID for this route
 	// ***************************************************************************
-	routeNav, err := bmw.NavFromGPX(gpxFile, routeID)
+	existingIDs, err := readExistingRouteIDs(*existingPtr)
 	if err != nil {
-		log.Println("BMW route XML could not be generated (Nav)!")
+		log.Println("Could not read the existing route IDs!")
 		log.Fatalln(err)
 	}
 
-	//routeNavigation, err := bmw.NavigationFromGPX(gpxFile, routeID)
-	routeNavigation, err := bmw.NavigationFromGPX(gpxFile, routeID)
+	// Only hashed IDs depend on the input, reading the files named by the options
+	// may take a while
+	var idContent []byte
+	if *routeIDPtr == 0 && *idModePtr == "hash" {
+		options, err := hashedOptions()
+		if err != nil {
+			log.Println("Could not read the files for the route ID!")
+			log.Fatalln(err)
+		}
+		idContent = append(append([]byte{}, gpxData...), options...)
+	}
+
+	routeID, err := getRouteID(*routeIDPtr, *idModePtr, idContent, existingIDs)
 	if err != nil {
-		log.Println("BMW route XML could not be generated (Nav)!")
+		log.Println("Could not determine the route ID!")
+		log.Fatalln(err)
+	}
+
+	// The creation time is used inside the XML files as well as for the archives
+	creationTime, err := getCreationTime(*creationTimePtr, gpxFile, *idModePtr == "hash")
+	if err != nil {
+		log.Println("Could not determine the creation time!")
 		log.Fatalln(err)
 	}
 
+	// Options for the conversion into the BMW format
+	var options bmw.Options
+	options.Language = *languagePtr
+	options.CreationTime = creationTime
+	options.TrackMatches = trackMatches
+	options.Distance.Method = *distancePtr
+	options.Distance.TwoDimensional = *distance2DPtr
+	options.Distance.ElevationSmoothing = *smoothingPtr
+	options.Duration.Profile = speedProfile
+	options.Duration.Distance = options.Distance
+	options.Duration.MovingTime = *durationPtr == "moving"
+	options.Duration.Stops.MaxSpeed = *stopSpeedPtr
+	options.Duration.Stops.MinDuration = *stopDurationPtr
+	if len(routeSpeeds) == 1 {
+		options.Duration.AverageSpeed = routeSpeeds[0]
+	} else {
+		options.RouteSpeeds = routeSpeeds
+	}
+	options.LegDescriptions = *legDescriptionsPtr
+	options.StatsTexts = *statsTextsPtr
+	if *constraintsPtr != "off" {
+		options.HeadUnit = &headUnit
+	}
+
+	// Report the stops of recorded tracks
+	if *stopsPtr != "" {
+		err = writeStops(*stopsPtr, gpxFile, options.Duration.Stops)
+		if err != nil {
+			log.Println("Could not write the stops!")
+			log.Fatalln(err)
+		}
+	}
+
+	// Only print the reports, if requested
+	if *inspectPtr == true {
+		err = writeInspectReport(os.Stdout, gpxFile, options)
+		if err != nil {
+			log.Println("Could not inspect the routes!")
+			log.Fatalln(err)
+		}
+	}
+	if *statsPtr != "" {
+		err = writeStatsReport(os.Stdout, gpxFile, options, *statsPtr)
+		if err != nil {
+			log.Println("Could not write the statistics!")
+			log.Fatalln(err)
+		}
+	}
+	if *inspectPtr == true || *statsPtr != "" {
+		return
+	}
+
 	// ***************************************************************************
-	// Marshal contents into XML text for both files
+	// Route picture
 	// ***************************************************************************
-	xmlNav, err := routeNav.ToXML()
+	var thumbnail = picture.Static()
+	var pictureOptions = picture.DefaultOptions()
+	if *picturePtr != "" {
+		// Picture supplied by the user
+		img, err := picture.FromFile(*picturePtr, pictureOptions)
+		if err == nil {
+			thumbnail, err = picture.EncodeJPEG(img)
+		}
+		if err != nil {
+			log.Println("Route picture could not be loaded!")
+			log.Fatalln(err)
+		}
+	} else if *staticPicturePtr == false {
+		// Draw the route
+		if *captionPtr == true {
+			pictureOptions.Caption = gpxFile.GetName()
+		}
+
+		// Offline map tiles as background
+		if *tilesPtr != "" {
+			tiles, err := mbtiles.Open(*tilesPtr)
+			if err != nil {
+				log.Println("Could not read the MBTiles file!")
+				log.Fatalln(err)
+			}
+			defer tiles.Close()
+
+			pictureOptions.Tiles = tiles
+			pictureOptions.Attribution = *tilesAttributionPtr
+			if pictureOptions.Attribution == "" {
+				pictureOptions.Attribution = tiles.Attribution()
+			}
+		}
+
+		img, err := picture.Render(gpxFile, pictureOptions)
+		if err == nil {
+			thumbnail, err = picture.EncodeJPEG(img)
+		}
+		if err != nil {
+			// The static picture is good enough in this case
+			log.Println("Route picture could not be drawn, using the static picture instead!")
+			log.Println(err)
+			thumbnail = picture.Static()
+		}
+	}
+
+	// The route files describe the picture as it is
+	var tourPicture bmw.TourPicture
+	tourPicture.Reference = bmw.PictureReference(routeID)
+	tourPicture.Encoding, tourPicture.Width, tourPicture.Height, err = picture.Info(thumbnail)
 	if err != nil {
-		log.Println("GPX contents could not be converted to BMW route format (Nav)!")
+		log.Println("Route picture is invalid!")
 		log.Fatalln(err)
 	}
+	options.Pictures = append(options.Pictures, tourPicture)
 
-	xmlNavigation, err := routeNavigation.ToXML()
+	// Elevation profile as second picture
+	var profile []byte
+	if *profilePtr == true && headUnit.MaxPictures != 1 {
+		img, err := picture.RenderProfile(gpxFile, pictureOptions)
+		if err == nil {
+			profile, err = picture.EncodeJPEG(img)
+		}
+		if err == nil {
+			var profilePicture bmw.TourPicture
+			profilePicture.Reference = bmw.ProfileReference(routeID)
+			profilePicture.Encoding, profilePicture.Width, profilePicture.Height, err = picture.Info(profile)
+			if err == nil {
+				options.Pictures = append(options.Pictures, profilePicture)
+			}
+		}
+		if err != nil {
+			// The route is fine without it
+			log.Println("Elevation profile could not be drawn, leaving it out!")
+			log.Println(err)
+			profile = nil
+		}
+	}
+
+	// ***************************************************************************
+	// Generate contents for XML file in folder "Nav" and "Navigation"
+	// ***************************************************************************
+	routeNav, err := bmw.NavFromGPX(gpxFile, routeID, options)
 	if err != nil {
-		log.Println("GPX contents could not be converted to BMW route format (Navigation)!")
+		log.Println("BMW route XML could not be generated (Nav)!")
 		log.Fatalln(err)
 	}
 
-	// We have to replace one XML tag so that it contains a newline
-	xmlNav = replaceAgoraCString(xmlNav)
+	//routeNavigation, err := bmw.NavigationFromGPX(gpxFile, routeID, options)
+	routeNavigation, err := bmw.NavigationFromGPX(gpxFile, routeID, options)
+	if err != nil {
+		log.Println("BMW route XML could not be generated (Nav)!")
+		log.Fatalln(err)
+	}
 
 	// ***************************************************************************
-	// Read image file data
+	// Marshal contents into XML text for both files
 	// ***************************************************************************
-	var thumbnail []byte
-	thumbnail, err = ioutil.ReadFile("routepicture.jpg")
+	// The car writes the empty element "AgoraCString" over two lines in this folder
+	xmlNav, err := routeNav.ToXML("AgoraCString")
 	if err != nil {
-		log.Println("Default route picture could not be loaded!")
+		log.Println("GPX contents could not be converted to BMW route format (Nav)!")
+		log.Fatalln(err)
+	}
+
+	xmlNavigation, err := routeNavigation.ToXML()
+	if err != nil {
+		log.Println("GPX contents could not be converted to BMW route format (Navigation)!")
 		log.Fatalln(err)
 	}
 
@@ -123,21 +673,25 @@ func main() {
 	// ***************************************************************************
 	var filesNav = []fileData{
 		{strconv.FormatInt(routeID, 10) + ".xml", xmlNav, 0700},
-		{"routepicture_" + strconv.FormatInt(routeID, 10) + ".jpg", thumbnail, 0700},
+		{bmw.PictureReference(routeID), thumbnail, 0700},
 	}
 	var filesNavigation = []fileData{
 		{strconv.FormatInt(routeID, 10) + ".xml", xmlNavigation, 0700},
-		{"routepicture_" + strconv.FormatInt(routeID, 10) + ".jpg", thumbnail, 0700},
+		{bmw.PictureReference(routeID), thumbnail, 0700},
+	}
+	if profile != nil {
+		filesNav = append(filesNav, fileData{bmw.ProfileReference(routeID), profile, 0700})
+		filesNavigation = append(filesNavigation, fileData{bmw.ProfileReference(routeID), profile, 0700})
 	}
 
 	// Create TAR archives
-	bufNav, err := filesToTarBuffer(filesNav)
+	bufNav, err := filesToTarBuffer(filesNav, creationTime)
 	if err != nil {
 		log.Println("Could not create the tarball file (Nav)!")
 		log.Fatalln(err)
 	}
 
-	bufNavigation, err := filesToTarBuffer(filesNavigation)
+	bufNavigation, err := filesToTarBuffer(filesNavigation, creationTime)
 	if err != nil {
 		log.Println("Could not create the tarball file (Navigation)!")
 		log.Fatalln(err)
@@ -168,7 +722,7 @@ func main() {
 	}
 
 	// Create the ZIP file containing the folder structure and the tar.gz-files
-	bufZip, err := filesToZipBuffer(filesZip)
+	bufZip, err := filesToZipBuffer(filesZip, creationTime)
 	if err != nil {
 		log.Println("Could not create the zip file!")
 		log.Fatalln(err)
@@ -191,22 +745,397 @@ func main() {
 	}
 }
 
+// getRouteID returns the route ID set on the command line, or generates one according
+// to idMode. Hashed IDs are derived from content. Generated IDs never collide with one
+// of the existing IDs.
+func getRouteID(routeID int64, idMode string, content []byte, existingIDs map[int64]bool) (int64, error) {
+	// The ID was set on the command line
+	if routeID != 0 {
+		if existingIDs[routeID] {
+			return routeID, errors.New("route ID " + strconv.FormatInt(routeID, 10) + " already exists")
+		}
+		return routeID, nil
+	}
+
+	// Generate IDs until we find one that is not in use. There are 9 million IDs,
+	// so this will not take long.
+	for attempt := 0; ; attempt++ {
+		if idMode == "hash" {
+			routeID = generateHashID(content, attempt)
+		} else {
+			routeID = generateRandomID()
+		}
+		if !existingIDs[routeID] {
+			return routeID, nil
+		}
+	}
+}
+
 // generateRandomID generates a random 7-digit number used as an ID for this route
 func generateRandomID() int64 {
-	rand.Seed(time.Now().UnixNano())
-	return int64(rand.Intn(9999999-1000000) + 1000000)
+	return routeIDRandom.Int63n(conMaxRouteID-conMinRouteID+1) + conMinRouteID
+}
+
+// generateHashID derives a 7-digit number from the content, i.e. the GPX file and the
+// options, so that the same file always gets the same ID. If this ID is already in
+// use, the next attempt returns another one.
+func generateHashID(content []byte, attempt int) int64 {
+	var hash = sha256.Sum256(append(append([]byte{}, content...), []byte(strconv.Itoa(attempt))...))
+	return int64(binary.BigEndian.Uint64(hash[:8])%uint64(conMaxRouteID-conMinRouteID+1)) + conMinRouteID
+}
+
+// hashedOptions returns the effective values of the command line options which change
+// the contents of the route, as part of the hashed route ID. Options left at their
+// default are included, so that setting an option to its default does not change
+// the ID. For options naming files, the hash of their contents is used.
+func hashedOptions() ([]byte, error) {
+	var options bytes.Buffer
+	var err error
+	flag.VisitAll(func(option *flag.Flag) {
+		if err != nil || unhashedOptions[option.Name] {
+			return
+		}
+		var value = option.Value.String()
+		if hashedFileOptions[option.Name] && value != "" {
+			value, err = hashPath(value)
+		}
+		options.WriteString(option.Name + "=" + value + "\n")
+	})
+	return options.Bytes(), err
+}
+
+// hashPath returns the SHA-256 hash of a file, or of the names and contents of all
+// files in a directory
+func hashPath(path string) (string, error) {
+	var hash = sha256.New()
+	var addFile = func(filename string) error {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(hash, file)
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		err = addFile(path)
+		return hex.EncodeToString(hash.Sum(nil)), err
+	}
+
+	// Directory: the files are walked in lexical order, so the hash does not depend
+	// on the order of the directory entries
+	err = filepath.Walk(path, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		name, err := filepath.Rel(path, filename)
+		if err != nil {
+			return err
+		}
+		hash.Write([]byte(filepath.ToSlash(name) + "\n"))
+		return addFile(filename)
+	})
+	return hex.EncodeToString(hash.Sum(nil)), err
 }
 
-// replaceAgoraCString corrects the xml element "AgoraCString"
-func replaceAgoraCString(input []byte) []byte {
-	var s = string(input[:])
-	s = strings.ReplaceAll(s, "<AgoraCString></AgoraCString>", "<AgoraCString>\n          </AgoraCString>")
-	var output = []byte(s)
-	return output
+// describeShortcutRisk describes where the navigation system will probably take a
+// shortcut
+func describeShortcutRisk(gpxFile gpx.GPX, risk gpx.ShortcutRisk) string {
+	var route = gpxFile.Routes[risk.Route]
+	return "route " + strconv.Itoa(risk.Route+1) + " \"" + route.Name + "\" may take a shortcut at " + formatCoordinates(risk.Latitude, risk.Longitude) +
+		" to waypoint \"" + risk.Destination.Name + "\" (" + bmw.DistanceText(risk.StraightDistance) + " in a straight line instead of " + bmw.DistanceText(risk.RouteDistance) + " along the route)"
 }
 
-// filesToTarBuffer writes the data contained in "files" in tar format into buffer
-func filesToTarBuffer(files []fileData) (bytes.Buffer, error) {
+// formatCoordinates formats latitude and longitude for messages
+func formatCoordinates(latitude float64, longitude float64) string {
+	return strconv.FormatFloat(latitude, 'f', 5, 64) + ", " + strconv.FormatFloat(longitude, 'f', 5, 64)
+}
+
+// writeInspectReport writes a report about the routes of the GPX file, the tracks
+// they follow and the legs between their waypoints
+func writeInspectReport(writer io.Writer, gpxFile gpx.GPX, options bmw.Options) error {
+	var lines []string
+
+	// Loop over the routes
+	for i, route := range gpxFile.Routes {
+		var durationOptions = options.Duration
+		if i < len(options.RouteSpeeds) && options.RouteSpeeds[i] > 0 {
+			durationOptions.AverageSpeed = options.RouteSpeeds[i]
+		}
+		legs, err := gpxFile.CalcLegs(route, options.TrackMatches[i], durationOptions)
+		if err != nil {
+			return err
+		}
+
+		// Route totals are the sum of the legs
+		var total gpx.Leg
+		for _, leg := range legs {
+			total.Distance = total.Distance + leg.Distance
+			total.Duration = total.Duration + leg.Duration
+		}
+		lines = append(lines, "Route "+strconv.Itoa(i+1)+" \""+route.Name+"\": "+strconv.Itoa(len(route.RouteWaypoints))+" waypoints, "+bmw.DistanceText(total.Distance)+", "+bmw.DurationText(total.Duration))
+
+		var match = options.TrackMatches[i]
+		if match.Matched() {
+			lines = append(lines, "  follows track "+strconv.Itoa(match.TrackIndex+1)+" \""+gpxFile.Tracks[match.TrackIndex].Name+"\" (confidence "+strconv.FormatFloat(match.Confidence*100, 'f', 0, 64)+" %)")
+		} else {
+			lines = append(lines, "  no matching track, using straight lines between the waypoints")
+		}
+
+		for j, leg := range legs {
+			var from = route.RouteWaypoints[leg.From].Name
+			var to = route.RouteWaypoints[leg.To].Name
+			lines = append(lines, "  "+bmw.LegDescription(j+1, leg)+" ("+from+" - "+to+")")
+		}
+	}
+
+	_, err := io.WriteString(writer, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// writeStatsReport prints statistics about the whole tour and every route, either
+// as text or as JSON
+func writeStatsReport(writer io.Writer, gpxFile gpx.GPX, options bmw.Options, format string) error {
+	type routeStats struct {
+		Name string `json:"name"`
+		gpx.Stats
+	}
+	var report struct {
+		Tour   gpx.Stats    `json:"tour"`
+		Routes []routeStats `json:"routes"`
+	}
+
+	report.Tour = gpxFile.CalcStats(options.TrackMatches, options.Distance)
+	for i, route := range gpxFile.Routes {
+		report.Routes = append(report.Routes, routeStats{route.Name, gpxFile.CalcRouteStats(route, options.TrackMatches[i], options.Distance)})
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(append(data, '\n'))
+		return err
+	}
+
+	// Text: one block for the tour and for each route
+	var describe = func(title string, stats gpx.Stats) []string {
+		return []string{
+			title,
+			"  " + bmw.StatsIntroduction(stats),
+			"  " + bmw.StatsDescription(stats),
+			"  area " + formatCoordinates(stats.MinLatitude, stats.MinLongitude) + " - " + formatCoordinates(stats.MaxLatitude, stats.MaxLongitude),
+		}
+	}
+	var lines = describe("Tour \""+gpxFile.GetName()+"\"", report.Tour)
+	for i, route := range report.Routes {
+		lines = append(lines, describe("Route "+strconv.Itoa(i+1)+" \""+route.Name+"\"", route.Stats)...)
+	}
+
+	_, err := io.WriteString(writer, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// writeStops writes the stops found in the recorded tracks into a CSV file, so that
+// they can be turned into waypoints
+func writeStops(csvPath string, gpxFile gpx.GPX, stopOptions gpx.StopOptions) error {
+	var records = [][]string{{"track", "latitude", "longitude", "start", "end", "minutes"}}
+
+	// Loop over the tracks
+	for _, track := range gpxFile.Tracks {
+		_, stops, err := track.CalcMovingTime(stopOptions)
+		if err != nil {
+			return err
+		}
+		for _, stop := range stops {
+			records = append(records, []string{
+				track.Name,
+				strconv.FormatFloat(stop.Latitude, 'f', -1, 64),
+				strconv.FormatFloat(stop.Longitude, 'f', -1, 64),
+				stop.Start.Format(time.RFC3339),
+				stop.End.Format(time.RFC3339),
+				strconv.FormatFloat(stop.Duration().Minutes(), 'f', 0, 64),
+			})
+		}
+	}
+
+	var buffer bytes.Buffer
+	var writer = csv.NewWriter(&buffer)
+	err := writer.WriteAll(records)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(csvPath, buffer.Bytes(), 0644)
+}
+
+// readExistingRouteIDs returns the IDs of all routes in a BMWData folder or in a
+// route zip file. Routes are stored as <ID>.tar.gz in these.
+func readExistingRouteIDs(path string) (map[int64]bool, error) {
+	var existingIDs = make(map[int64]bool)
+	var addID = func(filename string) {
+		var name = filepath.Base(filepath.ToSlash(filename))
+		if strings.HasSuffix(name, ".tar.gz") {
+			if id, err := strconv.ParseInt(strings.TrimSuffix(name, ".tar.gz"), 10, 64); err == nil {
+				existingIDs[id] = true
+			}
+		}
+	}
+
+	if path == "" {
+		return existingIDs, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return existingIDs, err
+	}
+
+	// Folder: walk through all subfolders
+	if info.IsDir() {
+		err = filepath.Walk(path, func(filename string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				addID(filename)
+			}
+			return err
+		})
+		return existingIDs, err
+	}
+
+	// Zip file: check all entries
+	zipReader, err := zip.OpenReader(path)
+	if err != nil {
+		return existingIDs, err
+	}
+	defer zipReader.Close()
+	for _, file := range zipReader.File {
+		addID(file.Name)
+	}
+
+	return existingIDs, nil
+}
+
+// parseAverageSpeeds reads the average speeds given on the command line. A single
+// value is used for all routes, multiple comma separated values are used for the
+// routes in the order of the GPX file.
+func parseAverageSpeeds(averageSpeeds string) ([]float64, error) {
+	var speeds []float64
+	var err error
+
+	if averageSpeeds == "" {
+		return speeds, err
+	}
+
+	// Loop over the values
+	for _, value := range strings.Split(averageSpeeds, ",") {
+		speed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return speeds, err
+		}
+		if speed <= 0 {
+			return speeds, errors.New("average speed has to be positive")
+		}
+		speeds = append(speeds, speed)
+	}
+
+	return speeds, err
+}
+
+// parseWaypointNumbers parses a comma separated list of waypoint numbers, counting
+// from 1, and returns their indexes
+func parseWaypointNumbers(numbers string) ([]int, error) {
+	var indexes []int
+	var err error
+
+	if numbers == "" {
+		return indexes, err
+	}
+
+	// Loop over the values
+	for _, value := range strings.Split(numbers, ",") {
+		number, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return indexes, err
+		}
+		if number < 1 {
+			return indexes, errors.New("waypoint numbers start at 1")
+		}
+		indexes = append(indexes, number-1)
+	}
+
+	return indexes, err
+}
+
+// parseRange parses a range like "20-80". Both values are optional, a missing value
+// is returned as 0.
+func parseRange(text string) (float64, float64, error) {
+	var from, to float64
+	var err error
+
+	if text == "" {
+		return from, to, err
+	}
+	var parts = strings.Split(text, "-")
+	if len(parts) != 2 {
+		return from, to, errors.New("a range consists of two values separated by \"-\"")
+	}
+	if value := strings.TrimSpace(parts[0]); value != "" {
+		if from, err = strconv.ParseFloat(value, 64); err != nil {
+			return from, to, err
+		}
+	}
+	if value := strings.TrimSpace(parts[1]); value != "" {
+		if to, err = strconv.ParseFloat(value, 64); err != nil {
+			return from, to, err
+		}
+	}
+	if from < 0 || to < 0 || (to > 0 && to <= from) {
+		return from, to, errors.New("the end of the range has to be after its start")
+	}
+
+	return from, to, err
+}
+
+// getCreationTime returns the creation time of the route. It is taken from the command
+// line, from the environment variable SOURCE_DATE_EPOCH, from the GPX metadata or,
+// if none of these is set, the current time. The environment comes before the
+// metadata, so that reproducible builds get the time they ask for. If the output has
+// to be reproducible (hashed route ID), conReproducibleTime is used instead of the
+// current time, so that the same input always results in the same output.
+func getCreationTime(creationTime string, gpxFile gpx.GPX, reproducible bool) (time.Time, error) {
+	// Command line
+	if creationTime != "" {
+		return time.Parse(time.RFC3339, creationTime)
+	}
+
+	// Environment, see https://reproducible-builds.org/specs/source-date-epoch/
+	if sourceDateEpoch := os.Getenv("SOURCE_DATE_EPOCH"); sourceDateEpoch != "" {
+		seconds, err := strconv.ParseInt(sourceDateEpoch, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.New("invalid SOURCE_DATE_EPOCH \"" + sourceDateEpoch + "\"")
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	// GPX metadata
+	if metadataTime, err := time.Parse(time.RFC3339, gpxFile.Metadata.Time); err == nil {
+		return metadataTime.UTC(), nil
+	}
+
+	if reproducible {
+		return conReproducibleTime, nil
+	}
+	return time.Now().UTC().Truncate(time.Second), nil
+}
+
+// filesToTarBuffer writes the data contained in "files" in tar format into buffer.
+// All files get the same modification time, so that the archive is reproducible.
+func filesToTarBuffer(files []fileData, modTime time.Time) (bytes.Buffer, error) {
 	var buffer bytes.Buffer
 
 	// Create tar writer
@@ -216,9 +1145,12 @@ func filesToTarBuffer(files []fileData) (bytes.Buffer, error) {
 	for _, file := range files {
 		// Write file header
 		var fileHdr = &tar.Header{
-			Name: file.filename,
-			Mode: file.mode,
-			Size: int64(len(file.content)),
+			Typeflag: tar.TypeReg,
+			Name:     file.filename,
+			Mode:     file.mode,
+			Size:     int64(len(file.content)),
+			ModTime:  modTime,
+			Format:   tar.FormatUSTAR,
 		}
 		if err := tarWriter.WriteHeader(fileHdr); err != nil {
 			return buffer, err
@@ -254,8 +1186,9 @@ func compressGzip(data bytes.Buffer) (bytes.Buffer, error) {
 	return buffer, err
 }
 
-// filesToZipBuffer writes the data contained in "files" in zip format into buffer
-func filesToZipBuffer(files []fileData) (bytes.Buffer, error) {
+// filesToZipBuffer writes the data contained in "files" in zip format into buffer.
+// All files get the same modification time, so that the archive is reproducible.
+func filesToZipBuffer(files []fileData, modTime time.Time) (bytes.Buffer, error) {
 	var buffer bytes.Buffer
 
 	// Create zip writer
@@ -264,7 +1197,13 @@ func filesToZipBuffer(files []fileData) (bytes.Buffer, error) {
 	// Loop over the files to add them into the archive
 	for _, file := range files {
 		// Create the file
-		f, err := zipWriter.Create(file.filename)
+		var fileHdr = &zip.FileHeader{
+			Name:     file.filename,
+			Method:   zip.Deflate,
+			Modified: modTime,
+		}
+		fileHdr.SetMode(os.FileMode(file.mode))
+		f, err := zipWriter.CreateHeader(fileHdr)
 		if err != nil {
 			return buffer, err
 		}